@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// AccessConfig restricts the network access to the API
+type AccessConfig struct {
+	// AllowedIPs are the IPs or CIDR ranges allowed to use the API. All are allowed if empty
+	AllowedIPs []string
+	// DeniedIPs are the IPs or CIDR ranges rejected, even if allowed
+	DeniedIPs []string
+	// AdminAddress is the address the management endpoints are served on.
+	// If empty, they are served with the rest of the API.
+	AdminAddress string
+	// UnprotectedAdmin serves the management endpoints on the API address
+	// without API keys. Otherwise, without keys nor AdminAddress, they are
+	// disabled as nothing tells the clients allowed apart
+	UnprotectedAdmin bool
+}
+
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	networks := []*net.IPNet{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP: %s", e)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range: %w", err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipFilterMiddleware rejects the clients in the denied ranges, and the ones
+// not in the allowed ranges if any
+func ipFilterMiddleware(access AccessConfig) (fiber.Handler, error) {
+	allowed, err := parseNetworks(access.AllowedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing allowed IPs: %w", err)
+	}
+	denied, err := parseNetworks(access.DeniedIPs)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing denied IPs: %w", err)
+	}
+
+	return func(c *fiber.Ctx) error {
+		ip := net.ParseIP(c.IP())
+		if ip == nil ||
+			containsIP(denied, ip) ||
+			(len(allowed) > 0 && !containsIP(allowed, ip)) {
+			log.Debug().Msgf("Rejected request from %s", c.IP())
+			return fiber.NewError(fiber.StatusForbidden, "access denied")
+		}
+		return c.Next()
+	}, nil
+}
+
+// unprotectedAdminMiddleware rejects the requests to the management
+// endpoints nothing protects: served on the API address, without API keys
+func unprotectedAdminMiddleware(c *fiber.Ctx) error {
+	return fiber.NewError(fiber.StatusForbidden, "disabled without API keys or admin address, see --unprotected-admin")
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestStats accounts the time spent by a request waiting for and running
+// the models. A request can run several inferences, possibly in parallel.
+type requestStats struct {
+	queue     atomic.Int64
+	inference atomic.Int64
+	tokens    atomic.Int64
+	// counted is true if the backend reported the tokens it generated
+	counted atomic.Bool
+	// sizes of the prompts and of the generated texts, for all the backends
+	promptBytes    atomic.Int64
+	generatedBytes atomic.Int64
+	// promptTokens are the tokens of the prompts, counted by the backends
+	// exposing their tokenizer. uncounted is true if a backend couldn't
+	promptTokens atomic.Int64
+	uncounted    atomic.Bool
+}
+
+// Accounting is the time spent by a request and the size of what it
+// processed, sent as headers or in the last event of a stream
+type Accounting struct {
+	QueueTimeMs     int64 `json:"queue_time_ms"`
+	InferenceTimeMs int64 `json:"inference_time_ms"`
+	// GeneratedTokens is only set for the backends reporting their tokens
+	GeneratedTokens *int64 `json:"generated_tokens,omitempty"`
+	// ProcessedTokens are the tokens of the prompts and the tokens
+	// generated. It is only set if the backends counted both
+	ProcessedTokens *int64 `json:"processed_tokens,omitempty"`
+	PromptBytes     int64  `json:"prompt_bytes"`
+	GeneratedBytes  int64  `json:"generated_bytes"`
+}
+
+// lock locks l, accounting the time spent waiting for it
+func (s *requestStats) lock(l *sync.Mutex) {
+	start := time.Now()
+	l.Lock()
+	if s != nil {
+		s.queue.Add(int64(time.Since(start)))
+	}
+}
+
+// run runs fn, accounting the time spent in it
+func (s *requestStats) run(fn func()) {
+	start := time.Now()
+	fn()
+	if s != nil {
+		s.inference.Add(int64(time.Since(start)))
+	}
+}
+
+// countTokens wraps a token callback to count the tokens generated
+func (s *requestStats) countTokens(tokenCallback func(string) bool) func(string) bool {
+	if s == nil {
+		return tokenCallback
+	}
+	s.counted.Store(true)
+	return func(token string) bool {
+		s.tokens.Add(1)
+		if tokenCallback == nil {
+			return true
+		}
+		return tokenCallback(token)
+	}
+}
+
+// processed accounts the size of a prompt and of the text generated from it
+func (s *requestStats) processed(prompt, generated string) {
+	if s != nil {
+		s.promptBytes.Add(int64(len(prompt)))
+		s.generatedBytes.Add(int64(len(generated)))
+	}
+}
+
+// promptTokensCounted accounts the tokens of a prompt, -1 for the backends
+// that can't count them
+func (s *requestStats) promptTokensCounted(tokens int) {
+	if s == nil {
+		return
+	}
+	if tokens < 0 {
+		s.uncounted.Store(true)
+		return
+	}
+	s.promptTokens.Add(int64(tokens))
+}
+
+// accounting returns the accounting of the request so far, nil if the
+// request is not accounted
+func (s *requestStats) accounting() *Accounting {
+	if s == nil {
+		return nil
+	}
+	a := &Accounting{
+		QueueTimeMs:     time.Duration(s.queue.Load()).Milliseconds(),
+		InferenceTimeMs: time.Duration(s.inference.Load()).Milliseconds(),
+		PromptBytes:     s.promptBytes.Load(),
+		GeneratedBytes:  s.generatedBytes.Load(),
+	}
+	if s.counted.Load() {
+		tokens := s.tokens.Load()
+		a.GeneratedTokens = &tokens
+	}
+	if !s.uncounted.Load() {
+		processed := s.promptTokens.Load() + s.tokens.Load()
+		a.ProcessedTokens = &processed
+	}
+	return a
+}
+
+func requestStatsFrom(c *fiber.Ctx) *requestStats {
+	s, _ := c.Locals("stats").(*requestStats)
+	return s
+}
+
+// statsMiddleware sets the accounting headers. They are not set on
+// streamed responses, as their headers are sent before the generation: the
+// last event of the stream carries the accounting instead.
+func statsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		s := &requestStats{}
+		c.Locals("stats", s)
+
+		err := c.Next()
+		if c.Response().IsBodyStream() {
+			return err
+		}
+
+		a := s.accounting()
+		c.Set("X-Queue-Time-Ms", strconv.FormatInt(a.QueueTimeMs, 10))
+		c.Set("X-Inference-Time-Ms", strconv.FormatInt(a.InferenceTimeMs, 10))
+		c.Set("X-Prompt-Bytes", strconv.FormatInt(a.PromptBytes, 10))
+		c.Set("X-Generated-Bytes", strconv.FormatInt(a.GeneratedBytes, 10))
+		if a.GeneratedTokens != nil {
+			c.Set("X-Generated-Tokens", strconv.FormatInt(*a.GeneratedTokens, 10))
+		}
+		if a.ProcessedTokens != nil {
+			c.Set("X-Processed-Tokens", strconv.FormatInt(*a.ProcessedTokens, 10))
+		}
+		return err
+	}
+}
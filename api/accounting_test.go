@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Accounting", func() {
+	It("sets the accounting headers", func() {
+		app := fiber.New()
+		app.Use(statsMiddleware())
+		app.Get("/", func(c *fiber.Ctx) error {
+			s := requestStatsFrom(c)
+			s.lock(&sync.Mutex{})
+			s.run(func() { time.Sleep(10 * time.Millisecond) })
+			s.countTokens(nil)("hel")
+			s.promptTokensCounted(2)
+			s.processed("prompt", "hel")
+			return c.SendString("hel")
+		})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Header.Get("X-Queue-Time-Ms")).To(Equal("0"))
+		Expect(resp.Header.Get("X-Inference-Time-Ms")).ToNot(Equal("0"))
+		Expect(resp.Header.Get("X-Generated-Tokens")).To(Equal("1"))
+		Expect(resp.Header.Get("X-Processed-Tokens")).To(Equal("3"))
+		Expect(resp.Header.Get("X-Prompt-Bytes")).To(Equal("6"))
+		Expect(resp.Header.Get("X-Generated-Bytes")).To(Equal("3"))
+	})
+	It("doesn't set the tokens if the backend doesn't report them", func() {
+		s := &requestStats{}
+		s.processed("prompt", "hello")
+		a := s.accounting()
+		Expect(a.GeneratedTokens).To(BeNil())
+		Expect(a.GeneratedBytes).To(Equal(int64(5)))
+	})
+	It("doesn't set the processed tokens if a backend can't count the prompt", func() {
+		s := &requestStats{}
+		Expect(*s.accounting().ProcessedTokens).To(BeZero())
+
+		s.promptTokensCounted(4)
+		s.countTokens(nil)("hello")
+		Expect(*s.accounting().ProcessedTokens).To(Equal(int64(5)))
+
+		// e.g. llama, generating another choice
+		s.promptTokensCounted(-1)
+		a := s.accounting()
+		Expect(a.ProcessedTokens).To(BeNil())
+		Expect(*a.GeneratedTokens).To(Equal(int64(1)))
+	})
+	It("sends the accounting in the last event of a stream", func() {
+		config := &Config{stats: &requestStats{}}
+		responses := make(chan OpenAIResponse, 2)
+		responses <- OpenAIResponse{Choices: []Choice{{Delta: &Message{Content: "hello"}}}}
+		config.stats.countTokens(nil)("hello")
+		config.stats.processed("prompt", "hello")
+		close(responses)
+
+		events := []OpenAIResponse{}
+		streamChat(&OpenAIRequest{}, config, responses, func(ev OpenAIResponse) {
+			events = append(events, ev)
+		})
+		last := events[len(events)-1]
+		Expect(last.Choices[0].FinishReason).To(Equal("stop"))
+		Expect(last.Accounting).ToNot(BeNil())
+		Expect(*last.Accounting.GeneratedTokens).To(Equal(int64(1)))
+		Expect(last.Accounting.PromptBytes).To(Equal(int64(6)))
+	})
+})
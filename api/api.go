@@ -1,27 +1,151 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
+	"sync"
 
 	model "github.com/go-skynet/LocalAI/pkg/model"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-func App(configFile string, loader *model.ModelLoader, uploadLimitMB, threads, ctxSize int, f16 bool, debug, disableMessage bool) *fiber.App {
+// App is the LocalAI API server. It can listen on its own, or be mounted
+// into another server with Fiber or Handler and started with Start.
+type App struct {
+	app *fiber.App
+	// admin serves the management endpoints on adminAddress, nil if they are
+	// served by app
+	admin        *fiber.App
+	adminAddress string
+
+	// jobs run in the background from Start to Shutdown: the scheduled jobs
+	// and checks, and the MQTT bridge
+	jobs []func(ctx context.Context)
+	// ctx is canceled by Shutdown, stopping the jobs and the checks
+	ctx    context.Context
+	cancel context.CancelFunc
+	// loader stops watching the models path on Shutdown
+	loader *model.ModelLoader
+
+	mu        sync.Mutex
+	started   bool
+	listeners []net.Listener
+	stopped   bool
+}
+
+type options struct {
+	configFile     string
+	loader         *model.ModelLoader
+	uploadLimitMB  int
+	threads        int
+	ctxSize        int
+	f16            bool
+	debug          bool
+	disableMessage bool
+	chaos          *ChaosConfig
+	access         *AccessConfig
+	scheduleFile   string
+	apiKeysFile    string
+	bridge         *BridgeConfig
+	integrity      IntegrityConfig
+}
+
+type AppOption func(*options)
+
+// WithModelLoader sets the loader of the models, required
+func WithModelLoader(loader *model.ModelLoader) AppOption {
+	return func(o *options) { o.loader = loader }
+}
+
+func WithConfigFile(configFile string) AppOption {
+	return func(o *options) { o.configFile = configFile }
+}
+
+func WithUploadLimitMB(limit int) AppOption {
+	return func(o *options) { o.uploadLimitMB = limit }
+}
+
+func WithThreads(threads int) AppOption {
+	return func(o *options) { o.threads = threads }
+}
+
+func WithContextSize(ctxSize int) AppOption {
+	return func(o *options) { o.ctxSize = ctxSize }
+}
+
+func WithF16(f16 bool) AppOption {
+	return func(o *options) { o.f16 = f16 }
+}
+
+func WithDebug(debug bool) AppOption {
+	return func(o *options) { o.debug = debug }
+}
+
+// WithDisableMessage hides the fiber startup message
+func WithDisableMessage(disable bool) AppOption {
+	return func(o *options) { o.disableMessage = disable }
+}
+
+func WithChaos(chaos *ChaosConfig) AppOption {
+	return func(o *options) { o.chaos = chaos }
+}
+
+func WithAccess(access *AccessConfig) AppOption {
+	return func(o *options) { o.access = access }
+}
+
+func WithScheduleFile(scheduleFile string) AppOption {
+	return func(o *options) { o.scheduleFile = scheduleFile }
+}
+
+func WithAPIKeysFile(apiKeysFile string) AppOption {
+	return func(o *options) { o.apiKeysFile = apiKeysFile }
+}
+
+// WithBridge serves the API over MQTT as well
+func WithBridge(bridge *BridgeConfig) AppOption {
+	return func(o *options) { o.bridge = bridge }
+}
+
+// WithIntegrityCheck checks the model files on a schedule
+func WithIntegrityCheck(integrity IntegrityConfig) AppOption {
+	return func(o *options) { o.integrity = integrity }
+}
+
+// New creates the API server. Nothing is served until Listen is called, or
+// the App is mounted into another server.
+func New(opts ...AppOption) (*App, error) {
+	o := &options{
+		uploadLimitMB: 15,
+		threads:       4,
+		ctxSize:       512,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.loader == nil {
+		return nil, errors.New("a model loader is required")
+	}
+
+	loader, threads, ctxSize, f16, debug := o.loader, o.threads, o.ctxSize, o.f16, o.debug
+
 	zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	if debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
 	// Return errors as JSON responses
-	app := fiber.New(fiber.Config{
-		BodyLimit:             uploadLimitMB * 1024 * 1024, // this is the default limit of 4MB
-		DisableStartupMessage: disableMessage,
+	appConfig := fiber.Config{
+		BodyLimit:             o.uploadLimitMB * 1024 * 1024, // this is the default limit of 4MB
+		DisableStartupMessage: o.disableMessage,
 		// Override default error handler
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
 			// Status code defaults to 500
@@ -40,7 +164,8 @@ func App(configFile string, loader *model.ModelLoader, uploadLimitMB, threads, c
 				},
 			)
 		},
-	})
+	}
+	app := fiber.New(appConfig)
 
 	if debug {
 		app.Use(logger.New(logger.Config{
@@ -48,30 +173,76 @@ func App(configFile string, loader *model.ModelLoader, uploadLimitMB, threads, c
 		}))
 	}
 
-	cm := make(ConfigMerger)
+	cm := NewConfigMerger()
 	if err := cm.LoadConfigs(loader.ModelPath); err != nil {
 		log.Error().Msgf("error loading config files: %s", err.Error())
 	}
 
-	if configFile != "" {
-		if err := cm.LoadConfigFile(configFile); err != nil {
+	if o.configFile != "" {
+		if err := cm.LoadConfigFile(o.configFile); err != nil {
 			log.Error().Msgf("error loading config file: %s", err.Error())
 		}
 	}
 
 	if debug {
-		for k, v := range cm {
+		for k, v := range cm.snapshot() {
 			log.Debug().Msgf("Model: %s (config: %+v)", k, v)
 		}
 	}
 	// Default middleware config
 	app.Use(recover.New())
+	app.Use(requestContextMiddleware)
 	app.Use(cors.New())
+	app.Use(statsMiddleware())
+
+	access := o.access
+	if access != nil && (len(access.AllowedIPs) > 0 || len(access.DeniedIPs) > 0) {
+		filter, err := ipFilterMiddleware(*access)
+		if err != nil {
+			return nil, err
+		}
+		app.Use(filter)
+	}
+
+	var keys []*APIKey
+	if o.apiKeysFile != "" {
+		var err error
+		keys, err = ReadAPIKeysFile(o.apiKeysFile)
+		if err != nil {
+			// don't expose the API if the keys can't be enforced
+			return nil, fmt.Errorf("error loading api keys file: %w", err)
+		}
+		app.Use(apiKeyMiddleware(keys))
+	}
+
+	if o.chaos != nil {
+		app.Use(chaosMiddleware(*o.chaos))
+	}
+
+	// the management endpoints are disabled when nothing tells the clients
+	// allowed to manage the server apart: no API keys, and no admin address
+	adminMiddleware := unrestrictedKeyMiddleware
+	if keys == nil && (access == nil || access.AdminAddress == "") {
+		if access != nil && access.UnprotectedAdmin {
+			log.Warn().Msg("The management endpoints are served without API keys on the API address: anyone reaching the API can manage the server")
+		} else {
+			log.Info().Msg("The management endpoints are disabled without API keys or admin address, see --unprotected-admin")
+			adminMiddleware = unprotectedAdminMiddleware
+		}
+	}
 
 	// openAI compatible API endpoint
 	app.Post("/v1/chat/completions", chatEndpoint(cm, debug, loader, threads, ctxSize, f16))
 	app.Post("/chat/completions", chatEndpoint(cm, debug, loader, threads, ctxSize, f16))
 
+	app.Get("/v1/streams/:id", resumeStreamEndpoint())
+	app.Get("/streams/:id", resumeStreamEndpoint())
+
+	app.Post("/v1/sessions", createSessionEndpoint())
+	app.Get("/v1/sessions/:id/export", unrestrictedKeyMiddleware, exportSessionEndpoint())
+	app.Post("/v1/sessions/import", adminMiddleware, importSessionEndpoint())
+	app.Delete("/v1/sessions/:id", unrestrictedKeyMiddleware, deleteSessionEndpoint())
+
 	app.Post("/v1/edits", editEndpoint(cm, debug, loader, threads, ctxSize, f16))
 	app.Post("/edits", editEndpoint(cm, debug, loader, threads, ctxSize, f16))
 
@@ -85,10 +256,179 @@ func App(configFile string, loader *model.ModelLoader, uploadLimitMB, threads, c
 
 	app.Post("/v1/engines/:model/embeddings", embeddingsEndpoint(cm, debug, loader, threads, ctxSize, f16))
 
+	app.Post("/v1/similarity", similarityEndpoint(cm, debug, loader, threads, ctxSize, f16))
+	app.Post("/similarity", similarityEndpoint(cm, debug, loader, threads, ctxSize, f16))
+
+	app.Post("/v1/classifications", classificationEndpoint(cm, debug, loader, threads, ctxSize, f16))
+	app.Post("/classifications", classificationEndpoint(cm, debug, loader, threads, ctxSize, f16))
+
+	app.Post("/v1/summarize", summarizationEndpoint(cm, debug, loader, threads, ctxSize, f16))
+	app.Post("/summarize", summarizationEndpoint(cm, debug, loader, threads, ctxSize, f16))
+
+	app.Post("/v1/translate", translationEndpoint(cm, debug, loader, threads, ctxSize, f16))
+	app.Post("/translate", translationEndpoint(cm, debug, loader, threads, ctxSize, f16))
+
 	app.Post("/v1/audio/transcriptions", transcriptEndpoint(cm, debug, loader, threads, ctxSize, f16))
 
-	app.Get("/v1/models", listModels(loader, cm))
-	app.Get("/models", listModels(loader, cm))
+	// polled by dashboards: let them skip the unchanged lists with If-None-Match
+	app.Get("/v1/models", etag.New(), listModels(loader, cm))
+	app.Get("/models", etag.New(), listModels(loader, cm))
+	// not without the prefix, as /models/errors is a management endpoint
+	app.Get("/v1/models/:model", retrieveModel(loader, cm))
+
+	integrity, err := newIntegrityChecker(o.integrity, cm, loader)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &App{app: app, ctx: ctx, cancel: cancel, loader: loader}
+
+	if o.scheduleFile != "" {
+		jobs, err := ReadScheduleFile(o.scheduleFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading schedule file: %w", err)
+		}
+		s := &scheduler{jobs: jobs, cm: cm, loader: loader, threads: threads, ctx: ctxSize, f16: f16}
+		a.jobs = append(a.jobs, s.run)
+	}
+
+	if integrity.schedule != nil {
+		a.jobs = append(a.jobs, integrity.run)
+	}
+
+	// management endpoints
+	admin := app
+	if access != nil && access.AdminAddress != "" {
+		admin = fiber.New(appConfig)
+		admin.Use(recover.New())
+		if keys != nil {
+			admin.Use(apiKeyMiddleware(keys))
+		}
+		a.admin, a.adminAddress = admin, access.AdminAddress
+	}
+
+	// the restricted api keys can't use them
+	admin.Get("/models/errors", adminMiddleware, modelLoadErrors(loader))
+	admin.Get("/memory", adminMiddleware, memoryStats(loader))
+	admin.Get("/backends", adminMiddleware, backendsStatus(loader))
+	admin.Post("/backends/:name/reset", adminMiddleware, resetBackend(loader))
+	admin.Get("/models/integrity", adminMiddleware, integrityReport(integrity))
+	admin.Post("/models/integrity", adminMiddleware, runIntegrityCheck(a.ctx, integrity))
+	admin.Get("/metrics", adminMiddleware, metricsEndpoint(loader, integrity))
+
+	admin.Get("/prompts", adminMiddleware, listPromptsEndpoint(loader))
+	admin.Get("/prompts/:name", adminMiddleware, getPromptEndpoint(loader))
+	admin.Put("/prompts/:name", adminMiddleware, savePromptEndpoint(loader))
+	admin.Delete("/prompts/:name", adminMiddleware, deletePromptEndpoint(loader))
+
+	if o.bridge != nil {
+		b := &bridge{config: *o.bridge, handler: app.Handler()}
+		a.jobs = append(a.jobs, b.run)
+	}
+
+	return a, nil
+}
+
+// Start runs the scheduled jobs and checks, and the MQTT bridge, until
+// Shutdown. Listen calls it: call it when mounting the App into another
+// server.
+func (a *App) Start() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started || a.stopped {
+		return
+	}
+	a.started = true
+	for _, job := range a.jobs {
+		go job(a.ctx)
+	}
+}
+
+// Listen serves the API on address, and the management endpoints on the
+// admin address if set. It blocks until Shutdown is called, or one of the
+// servers fails.
+func (a *App) Listen(address string) error {
+	network := a.app.Config().Network
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	servers, listeners := []*fiber.App{a.app}, []net.Listener{ln}
+	if a.admin != nil {
+		adminLn, err := net.Listen(network, a.adminAddress)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to listen on the admin address: %w", err)
+		}
+		servers, listeners = append(servers, a.admin), append(listeners, adminLn)
+	}
+
+	a.mu.Lock()
+	if a.stopped {
+		a.mu.Unlock()
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil
+	}
+	a.listeners = listeners
+	a.mu.Unlock()
+	a.Start()
+
+	// the first server stopping, on Shutdown or on an error, stops the other
+	errs := make(chan error, len(servers))
+	for i := range servers {
+		server, l := servers[i], listeners[i]
+		go func() { errs <- server.Listener(l) }()
+	}
+	err = <-errs
+	a.mu.Lock()
+	shutdown := a.stopped
+	a.mu.Unlock()
+	a.Shutdown()
+	for i := 1; i < len(servers); i++ {
+		<-errs
+	}
+	if shutdown {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops the servers, the scheduled jobs and checks, and the MQTT
+// bridge. The App can't be started again. It returns nil if the App was not
+// listening, e.g. mounted into another server.
+func (a *App) Shutdown() error {
+	a.mu.Lock()
+	listeners := a.listeners
+	a.listeners, a.stopped = nil, true
+	a.mu.Unlock()
+
+	a.cancel()
+	if err := a.loader.Close(); err != nil {
+		log.Debug().Msgf("failed closing the models path watcher: %s", err.Error())
+	}
+	if listeners == nil {
+		return nil
+	}
+
+	var err error
+	if a.admin != nil {
+		err = a.admin.Shutdown()
+	}
+	if appErr := a.app.Shutdown(); err == nil {
+		err = appErr
+	}
+	// if the servers were not serving yet, stop them from starting
+	for _, l := range listeners {
+		l.Close()
+	}
+	return err
+}
 
-	return app
+// Fiber returns the fiber app of the API, to mount it in another fiber app.
+// Call Start to run the scheduled jobs and checks, and the MQTT bridge.
+func (a *App) Fiber() *fiber.App {
+	return a.app
 }
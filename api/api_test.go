@@ -1,10 +1,20 @@
 package api_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	. "github.com/go-skynet/LocalAI/api"
 	"github.com/go-skynet/LocalAI/pkg/model"
@@ -16,16 +26,38 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+func readMQTTPacket(r *bufio.Reader) (byte, []byte) {
+	typ, err := r.ReadByte()
+	Expect(err).ToNot(HaveOccurred())
+	length, multiplier := 0, 1
+	for {
+		b, err := r.ReadByte()
+		Expect(err).ToNot(HaveOccurred())
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	Expect(err).ToNot(HaveOccurred())
+	return typ, body
+}
+
 var _ = Describe("API test", func() {
 
-	var app *fiber.App
+	var app *App
+	var err error
 	var modelLoader *model.ModelLoader
 	var client *openai.Client
 	var client2 *openaigo.Client
 	Context("API query", func() {
 		BeforeEach(func() {
 			modelLoader = model.NewModelLoader(os.Getenv("MODELS_PATH"))
-			app = App("", modelLoader, 15, 1, 512, false, true, true)
+			app, err = New(WithModelLoader(modelLoader), WithUploadLimitMB(15), WithThreads(1), WithDebug(true), WithDisableMessage(true),
+				WithAccess(&AccessConfig{UnprotectedAdmin: true}))
+			Expect(err).ToNot(HaveOccurred())
 			go app.Listen("127.0.0.1:9090")
 
 			defaultConfig := openai.DefaultConfig("")
@@ -56,6 +88,83 @@ var _ = Describe("API test", func() {
 			Expect(resp.Choices[0].Text).ToNot(BeEmpty())
 		})
 
+		It("returns the generation metadata", func() {
+			complete := func(body string) OpenAIResponse {
+				resp, err := http.Post("http://127.0.0.1:9090/v1/completions", "application/json", bytes.NewBufferString(body))
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				completion := OpenAIResponse{}
+				Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+				return completion
+			}
+
+			first := complete(`{"model":"testmodel","prompt":"abcdedfghikl","max_tokens":16,"return_metadata":true}`)
+			Expect(first.Metadata).ToNot(BeNil())
+			Expect(first.Metadata.Seed).ToNot(BeZero())
+			Expect(first.Metadata.ContentHash).To(HavePrefix("sha256:"))
+
+			// the same seed gives the same generation
+			second := complete(fmt.Sprintf(`{"model":"testmodel","prompt":"abcdedfghikl","max_tokens":16,"seed":%d,"return_metadata":true}`, first.Metadata.Seed))
+			Expect(second.Metadata.ContentHash).To(Equal(first.Metadata.ContentHash))
+		})
+
+		It("can generate completions in a response language", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/v1/completions", "application/json",
+				bytes.NewReader([]byte(`{"model":"testmodel","prompt":"abcdedfghikl","response_language":"Italian","max_tokens":16}`)))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			completion := openai.CompletionResponse{}
+			Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+			Expect(len(completion.Choices)).To(Equal(1))
+			Expect(completion.Choices[0].Text).ToNot(BeEmpty())
+		})
+
+		It("returns the text alone with Accept: text/plain", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:9090/v1/completions",
+				bytes.NewReader([]byte(`{"model":"testmodel","prompt":"abcdedfghikl","max_tokens":16}`)))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "text/plain")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).ToNot(BeEmpty())
+			Expect(string(body)).ToNot(HavePrefix("{"))
+		})
+
+		It("returns a JSON line per choice with Accept: application/x-ndjson", func() {
+			req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:9090/v1/completions",
+				bytes.NewReader([]byte(`{"model":"testmodel","prompt":["abcdedfghikl","mnopqrst"],"max_tokens":16}`)))
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept", "application/x-ndjson")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+
+			scanner := bufio.NewScanner(resp.Body)
+			indexes := []int{}
+			for scanner.Scan() {
+				choice := struct {
+					Index int    `json:"index"`
+					Text  string `json:"text"`
+				}{Index: -1}
+				Expect(json.Unmarshal(scanner.Bytes(), &choice)).To(Succeed())
+				indexes = append(indexes, choice.Index)
+			}
+			Expect(indexes).To(Equal([]int{0, 1}))
+		})
+
 		It("can generate chat completions ", func() {
 			resp, err := client.CreateChatCompletion(context.TODO(), openai.ChatCompletionRequest{Model: "testmodel", Messages: []openai.ChatCompletionMessage{openai.ChatCompletionMessage{Role: "user", Content: "abcdedfghikl"}}})
 			Expect(err).ToNot(HaveOccurred())
@@ -82,6 +191,179 @@ var _ = Describe("API test", func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error, status code: 500, message: could not load model - all backends returned error: 12 errors occurred:"))
 		})
+		It("returns not modified for an unchanged models list", func() {
+			resp, err := http.Get("http://127.0.0.1:9090/v1/models")
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			etag := resp.Header.Get("ETag")
+			Expect(etag).ToNot(BeEmpty())
+
+			req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:9090/v1/models", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("If-None-Match", etag)
+			resp, err = http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+		})
+		It("returns the accounting headers", func() {
+			resp, err := http.Get("http://127.0.0.1:9090/v1/models")
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.Header.Get("X-Queue-Time-Ms")).To(Equal("0"))
+			Expect(resp.Header.Get("X-Inference-Time-Ms")).To(Equal("0"))
+			Expect(resp.Header.Get("X-Processed-Tokens")).To(Equal("0"))
+		})
+		It("returns the accounting headers of a completion", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/v1/completions", "application/json",
+				bytes.NewReader([]byte(`{"model":"testmodel","prompt":"abcdedfghikl","max_tokens":16}`)))
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("X-Inference-Time-Ms")).ToNot(BeEmpty())
+			Expect(resp.Header.Get("X-Queue-Time-Ms")).ToNot(BeEmpty())
+			Expect(resp.Header.Get("X-Prompt-Bytes")).ToNot(Equal("0"))
+			Expect(resp.Header.Get("X-Generated-Bytes")).ToNot(Equal("0"))
+			// testmodel runs on llama, which reports its tokens
+			Expect(resp.Header.Get("X-Generated-Tokens")).ToNot(BeEmpty())
+			Expect(resp.Header.Get("X-Generated-Tokens")).ToNot(Equal("0"))
+			// but not the tokens of its prompt
+			Expect(resp.Header.Get("X-Processed-Tokens")).To(BeEmpty())
+		})
+		It("stops the completions after max_time", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/v1/completions", "application/json",
+				bytes.NewReader([]byte(`{"model":"testmodel","prompt":"abcdedfghikl","max_tokens":512,"max_time":0.001}`)))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			completion := OpenAIResponse{}
+			Expect(json.NewDecoder(resp.Body).Decode(&completion)).To(Succeed())
+			Expect(completion.Choices).To(HaveLen(1))
+			Expect(completion.Choices[0].FinishReason).To(Equal("timeout"))
+		})
+		It("returns the memory stats", func() {
+			resp, err := http.Get("http://127.0.0.1:9090/memory")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			stats := model.MemoryStats{}
+			Expect(json.NewDecoder(resp.Body).Decode(&stats)).To(Succeed())
+			Expect(stats.Total).ToNot(BeZero())
+			Expect(stats.Resident).ToNot(BeZero())
+		})
+		It("exports the memory metrics", func() {
+			resp, err := http.Get("http://127.0.0.1:9090/metrics")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			metrics, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(metrics)).To(ContainSubstring("# TYPE localai_memory_available_bytes gauge"))
+			Expect(string(metrics)).To(MatchRegexp(`(?m)^localai_resident_memory_bytes [1-9]`))
+			Expect(string(metrics)).To(ContainSubstring(`localai_memory_pressure_percent{window="10s"}`))
+		})
+		It("returns model load errors", func() {
+			_, err := client.CreateCompletion(context.TODO(), openai.CompletionRequest{Model: "foomodel", Prompt: "abcdedfghikl"})
+			Expect(err).To(HaveOccurred())
+
+			resp, err := http.Get("http://127.0.0.1:9090/models/errors")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			loadErrors := struct {
+				Errors []model.LoadEvent `json:"errors"`
+			}{}
+			Expect(json.NewDecoder(resp.Body).Decode(&loadErrors)).To(Succeed())
+			Expect(loadErrors.Errors).ToNot(BeEmpty())
+			Expect(loadErrors.Errors[0].Model).To(Equal("foomodel"))
+			Expect(loadErrors.Errors[0].Backend).ToNot(BeEmpty())
+			Expect(loadErrors.Errors[0].Error).ToNot(BeEmpty())
+		})
+		It("exports the model load metrics", func() {
+			_, err := client.CreateCompletion(context.TODO(), openai.CompletionRequest{Model: "foomodel", Prompt: "abcdedfghikl"})
+			Expect(err).To(HaveOccurred())
+
+			resp, err := http.Get("http://127.0.0.1:9090/metrics")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			metrics, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(metrics)).To(ContainSubstring(`localai_model_load_duration_seconds_count{model="foomodel",backend="llama",status="failure"} 1`))
+			Expect(string(metrics)).To(ContainSubstring("localai_models_loaded 0"))
+		})
+		It("returns the backends status", func() {
+			_, err := client.CreateCompletion(context.TODO(), openai.CompletionRequest{Model: "foomodel", Prompt: "abcdedfghikl"})
+			Expect(err).To(HaveOccurred())
+
+			resp, err := http.Get("http://127.0.0.1:9090/backends")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			status := struct {
+				Backends []model.BackendStatus `json:"backends"`
+			}{}
+			Expect(json.NewDecoder(resp.Body).Decode(&status)).To(Succeed())
+			backends := map[string]model.BackendStatus{}
+			for _, b := range status.Backends {
+				backends[b.Name] = b
+			}
+			Expect(backends[model.LlamaBackend].Status).To(Equal(model.BackendFailing))
+			Expect(backends[model.LlamaBackend].Reason).ToNot(BeEmpty())
+			Expect(backends[model.WhisperBackend].Status).To(Equal(model.BackendUnknown))
+		})
+		It("resets the backends", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/backends/llama/reset", "application/json", nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			resp, err = http.Post("http://127.0.0.1:9090/backends/foo/reset", "application/json", nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+		It("imports and exports sessions", func() {
+			session := Session{
+				Model:    "testmodel",
+				Messages: []Message{{Role: "user", Content: "abcdedfghikl"}, {Role: "assistant", Content: "mnopqrs"}},
+			}
+			body, err := json.Marshal(&session)
+			Expect(err).ToNot(HaveOccurred())
+
+			resp, err := http.Post("http://127.0.0.1:9090/v1/sessions/import", "application/json", bytes.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+			imported := Session{}
+			Expect(json.NewDecoder(resp.Body).Decode(&imported)).To(Succeed())
+			Expect(imported.ID).ToNot(BeEmpty())
+
+			resp2, err := http.Get("http://127.0.0.1:9090/v1/sessions/" + imported.ID + "/export")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp2.Body.Close()
+
+			exported := Session{}
+			Expect(json.NewDecoder(resp2.Body).Decode(&exported)).To(Succeed())
+			Expect(exported.ID).To(Equal(imported.ID))
+			Expect(exported.Model).To(Equal("testmodel"))
+			Expect(exported.Messages).To(Equal(session.Messages))
+		})
+		It("creates the sessions itself without API keys", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/v1/chat/completions", "application/json",
+				bytes.NewBufferString(`{"model":"testmodel","session_id":"mine","messages":[{"role":"user","content":"abcdedfghikl"}]}`))
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+			resp, err = http.Post("http://127.0.0.1:9090/v1/sessions", "application/json", nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			created := Session{}
+			Expect(json.NewDecoder(resp.Body).Decode(&created)).To(Succeed())
+			Expect(created.ID).To(MatchRegexp("^[0-9a-f]{32}$"))
+		})
 		It("transcribes audio", func() {
 			if runtime.GOOS != "linux" {
 				Skip("test supported only on linux")
@@ -123,12 +405,74 @@ var _ = Describe("API test", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(resp2.Data[0].Embedding).To(Equal(sunEmbedding))
 		})
+		It("requires a query to compute similarities", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/v1/similarity", "application/json", bytes.NewReader([]byte(`{"model":"text-embedding-ada-002","input":["sun"]}`)))
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+		It("requires labels to classify", func() {
+			resp, err := http.Post("http://127.0.0.1:9090/v1/classifications", "application/json", bytes.NewReader([]byte(`{"model":"testmodel","input":"I loved this movie!"}`)))
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+		It("computes similarities", func() {
+			if runtime.GOOS != "linux" {
+				Skip("test supported only on linux")
+			}
+			resp, err := client.CreateEmbeddings(
+				context.Background(),
+				openai.EmbeddingRequest{
+					Model: openai.AdaEmbeddingV2,
+					Input: []string{"sun"},
+				},
+			)
+			Expect(err).ToNot(HaveOccurred())
+			sunEmbedding := resp.Data[0].Embedding
+
+			similarity := func(req map[string]interface{}) (int, SimilarityResponse) {
+				body, err := json.Marshal(req)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := http.Post("http://127.0.0.1:9090/v1/similarity", "application/json", bytes.NewReader(body))
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				result := SimilarityResponse{}
+				if resp.StatusCode == http.StatusOK {
+					Expect(json.NewDecoder(resp.Body).Decode(&result)).To(Succeed())
+				}
+				return resp.StatusCode, result
+			}
+
+			status, result := similarity(map[string]interface{}{
+				"model":   "text-embedding-ada-002",
+				"query":   "sun",
+				"input":   []string{"sun", "cat"},
+				"vectors": [][]float32{sunEmbedding},
+			})
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(result.Data).To(HaveLen(3))
+			// the inputs come first, then the vectors
+			Expect(result.Data[0].Index).To(Equal(0))
+			Expect(result.Data[0].Similarity).To(BeNumerically("~", 1, 1e-4))
+			Expect(result.Data[1].Similarity).To(BeNumerically("<", result.Data[0].Similarity))
+			Expect(result.Data[2].Index).To(Equal(2))
+			Expect(result.Data[2].Similarity).To(BeNumerically("~", 1, 1e-4))
+
+			status, _ = similarity(map[string]interface{}{
+				"model":   "text-embedding-ada-002",
+				"query":   "sun",
+				"vectors": [][]float32{{1, 0}},
+			})
+			Expect(status).To(Equal(http.StatusBadRequest))
+		})
 	})
 
 	Context("Config file", func() {
 		BeforeEach(func() {
 			modelLoader = model.NewModelLoader(os.Getenv("MODELS_PATH"))
-			app = App(os.Getenv("CONFIG_FILE"), modelLoader, 5, 1, 512, false, true, true)
+			app, err = New(WithModelLoader(modelLoader), WithConfigFile(os.Getenv("CONFIG_FILE")), WithUploadLimitMB(5), WithThreads(1), WithDebug(true), WithDisableMessage(true))
+			Expect(err).ToNot(HaveOccurred())
 			go app.Listen("127.0.0.1:9090")
 
 			defaultConfig := openai.DefaultConfig("")
@@ -176,4 +520,699 @@ var _ = Describe("API test", func() {
 		})
 
 	})
+	Context("API keys", func() {
+		BeforeEach(func() {
+			keysFile := filepath.Join(GinkgoT().TempDir(), "keys.yaml")
+			err := os.WriteFile(keysFile, []byte("- key: restricted\n  models: [testmodel]\n  max_tokens: 16\n- key: admin\n"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+
+			modelLoader = model.NewModelLoader(os.Getenv("MODELS_PATH"))
+			app, err = New(WithModelLoader(modelLoader), WithUploadLimitMB(15), WithThreads(1), WithDebug(true), WithDisableMessage(true), WithAPIKeysFile(keysFile))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("rejects unknown keys", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Get("http://127.0.0.1:9090/v1/models")
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusUnauthorized))
+		})
+		It("rejects the models not allowed for the key", func() {
+			Eventually(func() (int, error) {
+				req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1:9090/v1/completions", bytes.NewBufferString(`{"model": "other", "prompt": "foo"}`))
+				if err != nil {
+					return 0, err
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer restricted")
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusForbidden))
+		})
+		It("lets only the unrestricted keys manage the server", func() {
+			status := func(method, url, key string) (int, error) {
+				req, err := http.NewRequest(method, url, bytes.NewBufferString(`{"model":"testmodel","messages":[]}`))
+				if err != nil {
+					return 0, err
+				}
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+key)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}
+			Eventually(func() (int, error) {
+				return status(http.MethodGet, "http://127.0.0.1:9090/memory", "restricted")
+			}, "2m").Should(Equal(http.StatusForbidden))
+			for _, url := range []string{"http://127.0.0.1:9090/metrics", "http://127.0.0.1:9090/backends", "http://127.0.0.1:9090/models/integrity", "http://127.0.0.1:9090/prompts"} {
+				Expect(status(http.MethodGet, url, "restricted")).To(Equal(http.StatusForbidden), url)
+				Expect(status(http.MethodGet, url, "admin")).To(Equal(http.StatusOK), url)
+			}
+			Expect(status(http.MethodPost, "http://127.0.0.1:9090/v1/sessions/import", "restricted")).To(Equal(http.StatusForbidden))
+			Expect(status(http.MethodPost, "http://127.0.0.1:9090/v1/sessions/import", "admin")).To(Equal(http.StatusCreated))
+		})
+	})
+	Context("Network access", func() {
+		BeforeEach(func() {
+			modelLoader = model.NewModelLoader(os.Getenv("MODELS_PATH"))
+			app, err = New(WithModelLoader(modelLoader), WithUploadLimitMB(15), WithThreads(1), WithDebug(true), WithDisableMessage(true), WithAccess(&AccessConfig{DeniedIPs: []string{"127.0.0.0/8"}, AdminAddress: "127.0.0.1:9091"}))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("rejects the denied IPs", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Get("http://127.0.0.1:9090/v1/models")
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusForbidden))
+		})
+		It("serves the management endpoints on the admin address", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Get("http://127.0.0.1:9091/models/errors")
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusOK))
+		})
+	})
+	Context("Model licenses", func() {
+		BeforeEach(func() {
+			modelsPath := GinkgoT().TempDir()
+			err := os.WriteFile(filepath.Join(modelsPath, "nc-model.yaml"), []byte(`name: nc-model
+description: A research model
+license: CC-BY-NC-4.0
+url: https://example.com/nc-model
+parameters:
+  model: nc-model.bin
+`), 0600)
+			Expect(err).ToNot(HaveOccurred())
+
+			modelLoader = model.NewModelLoader(modelsPath)
+			modelLoader.RequireLicenseAck = true
+			app, err = New(WithModelLoader(modelLoader), WithDisableMessage(true))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("lists the models metadata", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				resp, err = http.Get("http://127.0.0.1:9090/v1/models/nc-model")
+				return err
+			}, "2m").ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			info := OpenAIModel{}
+			Expect(json.NewDecoder(resp.Body).Decode(&info)).To(Succeed())
+			Expect(info).To(Equal(OpenAIModel{
+				ID:            "nc-model",
+				Object:        "model",
+				Description:   "A research model",
+				License:       "CC-BY-NC-4.0",
+				URL:           "https://example.com/nc-model",
+				NonCommercial: true,
+			}))
+
+			resp, err = http.Get("http://127.0.0.1:9090/v1/models/unknown")
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+		It("refuses the non-commercial models not acknowledged", func() {
+			var resp *http.Response
+			Eventually(func() error {
+				resp, err = http.Post("http://127.0.0.1:9090/v1/completions", "application/json", bytes.NewBufferString(`{"model":"nc-model","prompt":"abcdedfghikl"}`))
+				return err
+			}, "2m").ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+
+			// nor through the model file
+			resp, err = http.Post("http://127.0.0.1:9090/v1/completions", "application/json", bytes.NewBufferString(`{"model":"nc-model.bin","prompt":"abcdedfghikl"}`))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		})
+	})
+	Context("Model integrity", func() {
+		var source *httptest.Server
+		BeforeEach(func() {
+			// a newer version of good.bin
+			source = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Last-Modified", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+				w.Write([]byte("hello world"))
+			}))
+
+			modelsPath := GinkgoT().TempDir()
+			// sha256 of "hello"
+			checksum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+			for file, content := range map[string]string{
+				"good.bin":  "hello",
+				"bad.bin":   "hellp",
+				"plain.bin": "plain",
+				"good.yaml": "name: good\nsha256: " + checksum + "\nurl: " + source.URL + "\nparameters:\n  model: good.bin\n",
+				"bad.yaml":  "name: bad\nsha256: " + checksum + "\nparameters:\n  model: bad.bin\n",
+			} {
+				Expect(os.WriteFile(filepath.Join(modelsPath, file), []byte(content), 0600)).To(Succeed())
+			}
+
+			modelLoader = model.NewModelLoader(modelsPath)
+			app, err = New(WithModelLoader(modelLoader), WithDisableMessage(true), WithAccess(&AccessConfig{UnprotectedAdmin: true}))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+			source.Close()
+		})
+		It("checks the model files", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Post("http://127.0.0.1:9090/models/integrity", "", nil)
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusAccepted))
+
+			report := struct {
+				LastRun *time.Time   `json:"last_run"`
+				Models  []ModelCheck `json:"models"`
+			}{}
+			Eventually(func() (*time.Time, error) {
+				resp, err := http.Get("http://127.0.0.1:9090/models/integrity")
+				if err != nil {
+					return nil, err
+				}
+				defer resp.Body.Close()
+				if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+					return nil, err
+				}
+				return report.LastRun, nil
+			}, "1m").ShouldNot(BeNil())
+
+			checks := map[string]ModelCheck{}
+			for _, c := range report.Models {
+				checks[c.File] = c
+			}
+			Expect(checks["good.bin"].Status).To(Equal(IntegrityOK))
+			Expect(checks["good.bin"].UpdateAvailable).To(BeTrue())
+			Expect(checks["good.bin"].Updated).To(BeFalse())
+			Expect(checks["bad.bin"].Status).To(Equal(IntegrityCorrupted))
+			Expect(checks["plain.bin"].Status).To(Equal(IntegrityUnverified))
+
+			resp, err := http.Get("http://127.0.0.1:9090/metrics")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			metrics, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(metrics)).To(ContainSubstring(`localai_model_integrity_ok{model="bad",file="bad.bin",status="corrupted"} 0`))
+			Expect(string(metrics)).To(ContainSubstring(`localai_model_update_available{model="good",file="good.bin"} 1`))
+		})
+		It("doesn't update the model files to a download not matching their checksum", func() {
+			app.Shutdown()
+			app, err = New(WithModelLoader(modelLoader), WithDisableMessage(true), WithIntegrityCheck(IntegrityConfig{AutoUpdate: true}),
+				WithAccess(&AccessConfig{UnprotectedAdmin: true}))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+
+			Eventually(func() (int, error) {
+				resp, err := http.Post("http://127.0.0.1:9090/models/integrity", "", nil)
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusAccepted))
+
+			var good ModelCheck
+			Eventually(func() (string, error) {
+				resp, err := http.Get("http://127.0.0.1:9090/models/integrity")
+				if err != nil {
+					return "", err
+				}
+				defer resp.Body.Close()
+				report := struct {
+					Models []ModelCheck `json:"models"`
+				}{}
+				if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+					return "", err
+				}
+				for _, c := range report.Models {
+					if c.File == "good.bin" {
+						good = c
+					}
+				}
+				return good.File, nil
+			}, "1m").Should(Equal("good.bin"))
+
+			Expect(good.Updated).To(BeFalse())
+			Expect(good.Error).To(ContainSubstring("expected 2cf24dba"))
+			content, err := os.ReadFile(filepath.Join(modelLoader.ModelPath, "good.bin"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(content)).To(Equal("hello"))
+		})
+	})
+	Context("Prompt library", func() {
+		BeforeEach(func() {
+			modelLoader = model.NewModelLoader(GinkgoT().TempDir())
+			app, err = New(WithModelLoader(modelLoader), WithUploadLimitMB(15), WithThreads(1), WithDebug(true), WithDisableMessage(true),
+				WithAccess(&AccessConfig{UnprotectedAdmin: true}))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("stores prompts", func() {
+			Eventually(func() error {
+				req, err := http.NewRequest(http.MethodPut, "http://127.0.0.1:9090/prompts/triage", bytes.NewBufferString(`{"template": "Triage the {{.product}} ticket"}`))
+				if err != nil {
+					return err
+				}
+				req.Header.Set("Content-Type", "application/json")
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					return fmt.Errorf("unexpected status %d", resp.StatusCode)
+				}
+				return nil
+			}, "2m").Should(Succeed())
+
+			resp, err := http.Get("http://127.0.0.1:9090/prompts/triage")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			prompt := Prompt{}
+			Expect(json.NewDecoder(resp.Body).Decode(&prompt)).To(Succeed())
+			Expect(prompt.Template).To(Equal("Triage the {{.product}} ticket"))
+
+			req, err := http.NewRequest(http.MethodDelete, "http://127.0.0.1:9090/prompts/triage", nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp, err = http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+			resp, err = http.Get("http://127.0.0.1:9090/prompts/triage")
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+		It("rejects the requests with a prompt and a prompt_ref", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Post("http://127.0.0.1:9090/v1/completions", "application/json",
+					bytes.NewBufferString(`{"model":"testmodel","prompt":"foo","prompt_ref":"triage"}`))
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusBadRequest))
+		})
+	})
+	Context("Management without API keys", func() {
+		BeforeEach(func() {
+			modelLoader = model.NewModelLoader(GinkgoT().TempDir())
+			app, err = New(WithModelLoader(modelLoader), WithDisableMessage(true))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("refuses to write the prompts", func() {
+			Eventually(func() (int, error) {
+				req, err := http.NewRequest(http.MethodPut, "http://127.0.0.1:9090/prompts/triage", bytes.NewBufferString(`{"template": "Triage the ticket"}`))
+				if err != nil {
+					return 0, err
+				}
+				req.Header.Set("Content-Type", "application/json")
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusForbidden))
+
+			req, err := http.NewRequest(http.MethodDelete, "http://127.0.0.1:9090/prompts/triage", nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+		})
+		It("disables the management endpoints", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Get("http://127.0.0.1:9090/backends")
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusForbidden))
+
+			for _, url := range []string{"http://127.0.0.1:9090/models/integrity", "http://127.0.0.1:9090/v1/sessions/import"} {
+				resp, err := http.Post(url, "application/json", bytes.NewBufferString(`{}`))
+				Expect(err).ToNot(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			}
+		})
+	})
+	Context("Prompt library on the admin address", func() {
+		BeforeEach(func() {
+			keysFile := filepath.Join(GinkgoT().TempDir(), "keys.yaml")
+			err := os.WriteFile(keysFile, []byte("- key: restricted\n  models: [testmodel]\n- key: admin\n"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+
+			modelLoader = model.NewModelLoader(GinkgoT().TempDir())
+			app, err = New(WithModelLoader(modelLoader), WithUploadLimitMB(15), WithThreads(1), WithDebug(true), WithDisableMessage(true),
+				WithAPIKeysFile(keysFile), WithAccess(&AccessConfig{AdminAddress: "127.0.0.1:9091"}))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("requires an unrestricted key to write the prompts", func() {
+			put := func(key string) (int, error) {
+				req, err := http.NewRequest(http.MethodPut, "http://127.0.0.1:9091/prompts/triage", bytes.NewBufferString(`{"template": "Triage the ticket"}`))
+				if err != nil {
+					return 0, err
+				}
+				req.Header.Set("Content-Type", "application/json")
+				if key != "" {
+					req.Header.Set("Authorization", "Bearer "+key)
+				}
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}
+			Eventually(func() (int, error) { return put("") }, "2m").Should(Equal(http.StatusUnauthorized))
+			Expect(put("restricted")).To(Equal(http.StatusForbidden))
+			Expect(put("admin")).To(Equal(http.StatusOK))
+		})
+	})
+	Context("Chaos mode", func() {
+		BeforeEach(func() {
+			modelLoader = model.NewModelLoader(os.Getenv("MODELS_PATH"))
+			app, err = New(WithModelLoader(modelLoader), WithUploadLimitMB(15), WithThreads(1), WithDebug(true), WithDisableMessage(true), WithChaos(&ChaosConfig{ErrorRate: 1}))
+			Expect(err).ToNot(HaveOccurred())
+			go app.Listen("127.0.0.1:9090")
+		})
+		AfterEach(func() {
+			app.Shutdown()
+		})
+		It("injects errors", func() {
+			Eventually(func() (int, error) {
+				resp, err := http.Get("http://127.0.0.1:9090/v1/models")
+				if err != nil {
+					return 0, err
+				}
+				resp.Body.Close()
+				return resp.StatusCode, nil
+			}, "2m").Should(Equal(http.StatusServiceUnavailable))
+		})
+	})
+	Context("MQTT bridge", func() {
+		// broker accepts the connection of the bridge and its subscription, and
+		// returns the functions publishing the requests and reading the responses
+		broker := func(l net.Listener) (func(string), func() map[string]interface{}) {
+			conn, err := l.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(conn.Close)
+			r := bufio.NewReader(conn)
+
+			typ, _ := readMQTTPacket(r)
+			Expect(typ).To(Equal(byte(0x10)))
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+			typ, body := readMQTTPacket(r)
+			Expect(typ).To(Equal(byte(0x82)))
+			conn.Write([]byte{0x90, 0x03, body[0], body[1], 0x00})
+
+			publish := func(payload string) {
+				p := append([]byte{0x00, 0x08}, "requests"...)
+				p = append(p, payload...)
+				conn.Write(append([]byte{0x30, byte(len(p))}, p...))
+			}
+			response := func() map[string]interface{} {
+				typ, body := readMQTTPacket(r)
+				for typ == 0xc0 {
+					conn.Write([]byte{0xd0, 0x00})
+					typ, body = readMQTTPacket(r)
+				}
+				Expect(typ).To(Equal(byte(0x30)))
+				Expect(string(body[2:11])).To(Equal("responses"))
+				res := map[string]interface{}{}
+				Expect(json.Unmarshal(body[11:], &res)).To(Succeed())
+				return res
+			}
+			return publish, response
+		}
+
+		It("answers the requests published on the topic", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer l.Close()
+
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true),
+				WithBridge(&BridgeConfig{Broker: "tcp://" + l.Addr().String(), Topic: "requests", ResponseTopic: "responses", ClientID: "localai"}))
+			Expect(err).ToNot(HaveOccurred())
+			app.Start()
+			defer app.Shutdown()
+			publish, response := broker(l)
+
+			publish(`{"id":"1","endpoint":"models"}`)
+			res := response()
+			Expect(res["id"]).To(Equal("1"))
+			Expect(res["status"]).To(BeEquivalentTo(http.StatusNotFound))
+
+			publish(`{"id":"2","endpoint":"completions","request":{"model":"foomodel","prompt":"abcdedfghikl"}}`)
+			res = response()
+			Expect(res["id"]).To(Equal("2"))
+			Expect(res["status"]).To(BeEquivalentTo(http.StatusInternalServerError))
+			Expect(res["response"]).To(HaveKey("error"))
+		})
+		It("applies the IPs allowed to the broker", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer l.Close()
+
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true),
+				WithAccess(&AccessConfig{AllowedIPs: []string{"10.0.0.0/8"}}),
+				WithBridge(&BridgeConfig{Broker: "tcp://" + l.Addr().String(), Topic: "requests", ResponseTopic: "responses", ClientID: "localai"}))
+			Expect(err).ToNot(HaveOccurred())
+			app.Start()
+			defer app.Shutdown()
+			publish, response := broker(l)
+
+			publish(`{"id":"1","endpoint":"completions","request":{"model":"foomodel","prompt":"abcdedfghikl"}}`)
+			res := response()
+			Expect(res["id"]).To(Equal("1"))
+			Expect(res["status"]).To(BeEquivalentTo(http.StatusForbidden))
+		})
+	})
+	Context("NATS bridge", func() {
+		It("answers the requests on their reply subject", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer l.Close()
+
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true),
+				WithBridge(&BridgeConfig{Broker: "nats://" + l.Addr().String(), Topic: "requests", ResponseTopic: "responses", ClientID: "localai"}))
+			Expect(err).ToNot(HaveOccurred())
+			app.Start()
+			defer app.Shutdown()
+
+			// a minimal server: accept the connection and the subscription
+			conn, err := l.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			conn.Write([]byte("INFO {\"server_id\":\"test\",\"version\":\"2.9.0\",\"proto\":1,\"max_payload\":1048576}\r\n"))
+			readLine := func() string {
+				for {
+					line, err := r.ReadString('\n')
+					Expect(err).ToNot(HaveOccurred())
+					line = strings.TrimSpace(line)
+					if line == "PING" {
+						conn.Write([]byte("PONG\r\n"))
+						continue
+					}
+					return line
+				}
+			}
+			Expect(readLine()).To(HavePrefix("CONNECT "))
+			Expect(strings.Fields(readLine())).To(Equal([]string{"SUB", "requests", "1"}))
+
+			publish := func(reply, payload string) {
+				if reply != "" {
+					reply += " "
+				}
+				fmt.Fprintf(conn, "MSG requests 1 %s%d\r\n%s\r\n", reply, len(payload), payload)
+			}
+			response := func(subject string) map[string]interface{} {
+				var size int
+				_, err := fmt.Sscanf(readLine(), "PUB "+subject+" %d", &size)
+				Expect(err).ToNot(HaveOccurred())
+				body := make([]byte, size+2)
+				_, err = io.ReadFull(r, body)
+				Expect(err).ToNot(HaveOccurred())
+				res := map[string]interface{}{}
+				Expect(json.Unmarshal(body[:size], &res)).To(Succeed())
+				return res
+			}
+
+			publish("_INBOX.1", `{"id":"1","endpoint":"models"}`)
+			res := response("_INBOX.1")
+			Expect(res["id"]).To(Equal("1"))
+			Expect(res["status"]).To(BeEquivalentTo(http.StatusNotFound))
+
+			publish("", `{"id":"2","endpoint":"completions","request":{"model":"foomodel","prompt":"abcdedfghikl"}}`)
+			res = response("responses")
+			Expect(res["id"]).To(Equal("2"))
+			Expect(res["status"]).To(BeEquivalentTo(http.StatusInternalServerError))
+		})
+	})
+	Context("Embedded", func() {
+		It("serves through a net/http handler", func() {
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true))
+			Expect(err).ToNot(HaveOccurred())
+			server := httptest.NewServer(app.Handler())
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/v1/models")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("ETag")).ToNot(BeEmpty())
+
+			resp, err = http.Get(server.URL + "/v1/streams/unknown")
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+		It("cancels the context of the requests when the client is gone", func() {
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true))
+			Expect(err).ToNot(HaveOccurred())
+			canceled := make(chan struct{})
+			app.Fiber().Get("/wait", func(c *fiber.Ctx) error {
+				<-c.UserContext().Done()
+				close(canceled)
+				return nil
+			})
+			server := httptest.NewServer(app.Handler())
+			defer server.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/wait", nil)
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				_, err := http.DefaultClient.Do(req)
+				Expect(err).To(HaveOccurred())
+			}()
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+			Eventually(canceled).Should(BeClosed())
+		})
+		It("starts the background jobs and shuts down without listening", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer l.Close()
+
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true),
+				WithBridge(&BridgeConfig{Broker: "tcp://" + l.Addr().String(), Topic: "requests", ClientID: "localai"}))
+			Expect(err).ToNot(HaveOccurred())
+
+			// the bridge connects to the broker once started
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				if conn, err := l.Accept(); err == nil {
+					accepted <- conn
+				}
+			}()
+			Consistently(accepted, "200ms").ShouldNot(Receive())
+			app.Start()
+			var conn net.Conn
+			Eventually(accepted).Should(Receive(&conn))
+			defer conn.Close()
+
+			Expect(app.Shutdown()).To(Succeed())
+		})
+		It("returns the errors of the admin address", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer l.Close()
+
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true),
+				WithAccess(&AccessConfig{AdminAddress: l.Addr().String()}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(app.Listen("127.0.0.1:9090")).To(MatchError(ContainSubstring("admin address")))
+
+			// the API address is released
+			l2, err := net.Listen("tcp", "127.0.0.1:9090")
+			Expect(err).ToNot(HaveOccurred())
+			l2.Close()
+		})
+		It("stops listening on Shutdown", func() {
+			app, err = New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithDisableMessage(true),
+				WithAccess(&AccessConfig{AdminAddress: "127.0.0.1:9091"}))
+			Expect(err).ToNot(HaveOccurred())
+			listened := make(chan error)
+			go func() { listened <- app.Listen("127.0.0.1:9090") }()
+			Eventually(func() error {
+				resp, err := http.Get("http://127.0.0.1:9091/backends")
+				if err == nil {
+					resp.Body.Close()
+				}
+				return err
+			}).Should(Succeed())
+
+			Expect(app.Shutdown()).To(Succeed())
+			Eventually(listened).Should(Receive(BeNil()))
+			_, err = http.Get("http://127.0.0.1:9091/backends")
+			Expect(err).To(HaveOccurred())
+		})
+		It("requires a model loader", func() {
+			_, err := New()
+			Expect(err).To(HaveOccurred())
+		})
+		It("fails on invalid options", func() {
+			_, err := New(WithModelLoader(model.NewModelLoader(GinkgoT().TempDir())), WithAccess(&AccessConfig{AllowedIPs: []string{"not an ip"}}))
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
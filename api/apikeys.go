@@ -0,0 +1,170 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// APIKey restricts what the clients using a key can request
+type APIKey struct {
+	Key  string `yaml:"key"`
+	Name string `yaml:"name"`
+	// Models the key can use. All the models are allowed if empty
+	Models []string `yaml:"models"`
+	// Defaults are applied before the parameters of the request,
+	// Overrides after them, so they can't be changed by the client
+	Defaults  OpenAIRequest `yaml:"defaults"`
+	Overrides OpenAIRequest `yaml:"overrides"`
+	// MaxTokens caps the tokens generated per request, if set
+	MaxTokens int `yaml:"max_tokens"`
+	// MaxN caps the choices generated per request. It is 1 for the
+	// restricted keys if not set
+	MaxN int `yaml:"max_n"`
+
+	// restricted is true if the key limits the models, the parameters or
+	// the tokens: it can't manage the server then
+	restricted bool
+	// overridden are the yaml names of the Overrides set in the file, which
+	// apply even with their zero value
+	overridden []string
+}
+
+func (k *APIKey) allows(model string) bool {
+	if len(k.Models) == 0 {
+		return true
+	}
+	for _, m := range k.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// apply merges the key settings with the parameters of a request
+func (k *APIKey) apply(config *Config, input *OpenAIRequest) {
+	updateConfig(config, &k.Defaults)
+	updateConfig(config, input)
+	updateConfig(config, &k.Overrides)
+	// updateConfig skips the zero values, e.g. temperature: 0
+	overrides, request := reflect.ValueOf(k.Overrides), reflect.ValueOf(&config.OpenAIRequest).Elem()
+	for _, name := range k.overridden {
+		if i, exists := requestFields[name]; exists {
+			request.Field(i).Set(overrides.Field(i))
+		}
+	}
+
+	if k.MaxTokens != 0 && (config.Maxtokens == 0 || config.Maxtokens > k.MaxTokens) {
+		config.Maxtokens = k.MaxTokens
+	}
+
+	// the choices are generated from the request, not from the config
+	maxN := k.MaxN
+	if maxN == 0 && k.restricted {
+		maxN = 1
+	}
+	if maxN != 0 && input.N > maxN {
+		input.N = maxN
+	}
+}
+
+// requestFields are the indexes of the fields of OpenAIRequest by yaml name
+var requestFields = func() map[string]int {
+	fields := map[string]int{}
+	t := reflect.TypeOf(OpenAIRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(t.Field(i).Name)
+		}
+		fields[name] = i
+	}
+	return fields
+}()
+
+func ReadAPIKeysFile(file string) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read api keys file: %w", err)
+	}
+	if err := yaml.Unmarshal(f, &keys); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal api keys file: %w", err)
+	}
+	// the overrides set, whatever their value
+	overrides := []struct {
+		Overrides map[string]interface{} `yaml:"overrides"`
+	}{}
+	if err := yaml.Unmarshal(f, &overrides); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal api keys file: %w", err)
+	}
+
+	for i, k := range keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("api key %d (%s): key is required", i, k.Name)
+		}
+		for name := range overrides[i].Overrides {
+			if _, exists := requestFields[name]; !exists {
+				return nil, fmt.Errorf("api key %d (%s): unknown override %s", i, k.Name, name)
+			}
+			k.overridden = append(k.overridden, name)
+		}
+		sort.Strings(k.overridden)
+		k.restricted = len(k.Models) > 0 || k.MaxTokens != 0 || k.MaxN != 0 || len(k.overridden) > 0
+	}
+	return keys, nil
+}
+
+// apiKeyMiddleware rejects the requests without a known key, and stores the
+// key of the request to be looked up by the endpoints with requestAPIKey
+func apiKeyMiddleware(keys []*APIKey) fiber.Handler {
+	byKey := make(map[string]*APIKey, len(keys))
+	for _, k := range keys {
+		byKey[k.Key] = k
+	}
+
+	return func(c *fiber.Ctx) error {
+		bearer := strings.TrimPrefix(c.Get("authorization"), "Bearer ")
+		key, exists := byKey[bearer]
+		if bearer == "" || !exists {
+			return fiber.NewError(fiber.StatusUnauthorized, "invalid api key")
+		}
+		c.Locals("apikey", key)
+		return c.Next()
+	}
+}
+
+// unrestrictedKeyMiddleware rejects the requests with a restricted key, for
+// the endpoints managing the server
+func unrestrictedKeyMiddleware(c *fiber.Ctx) error {
+	if key := requestAPIKey(c); key != nil && key.restricted {
+		return fiber.NewError(fiber.StatusForbidden, "not allowed for this api key")
+	}
+	return c.Next()
+}
+
+// requestOwner returns the credential identifying the client of the
+// request, to scope the resources it creates (e.g. resumable streams). It is
+// the bearer token, whether api keys are enabled or not, so it is empty for
+// the clients not sending any.
+func requestOwner(c *fiber.Ctx) string {
+	return strings.TrimPrefix(c.Get("authorization"), "Bearer ")
+}
+
+// sameOwner compares the owners in constant time, as they are credentials
+func sameOwner(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// requestAPIKey returns the key of the request, or nil if keys are not enabled
+func requestAPIKey(c *fiber.Ctx) *APIKey {
+	key, _ := c.Locals("apikey").(*APIKey)
+	return key
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API keys", func() {
+	readKeys := func(content string) []*APIKey {
+		file := filepath.Join(GinkgoT().TempDir(), "keys.yaml")
+		ExpectWithOffset(1, os.WriteFile(file, []byte(content), 0600)).To(Succeed())
+		keys, err := ReadAPIKeysFile(file)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return keys
+	}
+
+	It("tells the restricted keys apart", func() {
+		keys := readKeys("- key: admin\n  defaults:\n    temperature: 0.2\n- key: models\n  models: [testmodel]\n- key: overrides\n  overrides:\n    top_k: 40\n- key: tokens\n  max_tokens: 16\n")
+		Expect(keys[0].restricted).To(BeFalse())
+		for _, k := range keys[1:] {
+			Expect(k.restricted).To(BeTrue(), k.Key)
+		}
+	})
+	It("caps the tokens and the choices", func() {
+		keys := readKeys("- key: restricted\n  max_tokens: 16\n- key: choices\n  max_tokens: 16\n  max_n: 3\n- key: admin\n")
+
+		config, input := &Config{}, &OpenAIRequest{Maxtokens: 100, N: 5}
+		keys[0].apply(config, input)
+		Expect(config.Maxtokens).To(Equal(16))
+		Expect(input.N).To(Equal(1))
+
+		config, input = &Config{}, &OpenAIRequest{N: 5}
+		keys[1].apply(config, input)
+		Expect(config.Maxtokens).To(Equal(16))
+		Expect(input.N).To(Equal(3))
+
+		config, input = &Config{}, &OpenAIRequest{Maxtokens: 100, N: 5}
+		keys[2].apply(config, input)
+		Expect(config.Maxtokens).To(Equal(100))
+		Expect(input.N).To(Equal(5))
+	})
+	It("overrides the parameters with their zero value", func() {
+		keys := readKeys("- key: deterministic\n  overrides:\n    temperature: 0\n    echo: false\n    top_k: 0\n")
+		Expect(keys[0].restricted).To(BeTrue())
+
+		config, input := &Config{}, &OpenAIRequest{Temperature: 0.9, Echo: true, TopK: 40, TopP: 0.5}
+		keys[0].apply(config, input)
+		Expect(config.Temperature).To(BeZero())
+		Expect(config.Echo).To(BeFalse())
+		Expect(config.TopK).To(BeZero())
+		// not overridden
+		Expect(config.TopP).To(Equal(0.5))
+
+		file := filepath.Join(GinkgoT().TempDir(), "keys.yaml")
+		Expect(os.WriteFile(file, []byte("- key: typo\n  overrides:\n    temprature: 0\n"), 0600)).To(Succeed())
+		_, err := ReadAPIKeysFile(file)
+		Expect(err).To(MatchError(ContainSubstring("unknown override temprature")))
+	})
+})
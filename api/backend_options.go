@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	gpt2 "github.com/go-skynet/go-gpt2.cpp"
+	llama "github.com/go-skynet/go-llama.cpp"
+	gpt4all "github.com/nomic/gpt4all/gpt4all-bindings/golang"
+)
+
+// optionField returns the field of the options struct matching the key,
+// ignoring case and underscores: "typical_p" matches TypicalP.
+func optionField(options reflect.Value, key string) (reflect.Value, bool) {
+	name := strings.ReplaceAll(key, "_", "")
+	for i := 0; i < options.NumField(); i++ {
+		f := options.Type().Field(i)
+		if f.IsExported() && strings.EqualFold(f.Name, name) {
+			return options.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setOption sets the field to the value read from the model config, if the
+// types are compatible
+func setOption(field reflect.Value, key string, value interface{}) error {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return fmt.Errorf("backend option %s: missing value", key)
+	}
+
+	kindOf := func(k reflect.Kind) string {
+		switch k {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return "number"
+		case reflect.Bool:
+			return "bool"
+		case reflect.String:
+			return "string"
+		}
+		return k.String()
+	}
+
+	if kindOf(field.Kind()) != kindOf(v.Kind()) || !v.CanConvert(field.Type()) {
+		return fmt.Errorf("backend option %s: expected a %s, got %v", key, kindOf(field.Kind()), value)
+	}
+	if field.CanInt() && v.CanFloat() && v.Float() != float64(int64(v.Float())) {
+		return fmt.Errorf("backend option %s: expected an integer, got %v", key, value)
+	}
+	field.Set(v.Convert(field.Type()))
+	return nil
+}
+
+// setOptions sets the fields of the options struct pointed by target from
+// the backend options of the model config. Keys without a matching field are
+// ignored, as they can be meant for another options struct of the backend.
+func setOptions(target interface{}, options map[string]interface{}) error {
+	t := reflect.ValueOf(target).Elem()
+	for k, v := range options {
+		if field, exists := optionField(t, k); exists {
+			if err := setOption(field, k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// backendOptionsTargets returns the options structs of the backend the
+// backend options can set, false if the backend doesn't support them
+func backendOptionsTargets(backend string) ([]interface{}, bool) {
+	switch strings.ToLower(backend) {
+	case model.LlamaBackend:
+		return []interface{}{&llama.ModelOptions{}, &llama.PredictOptions{}}, true
+	case model.Gpt4AllLlamaBackend, model.Gpt4AllMptBackend, model.Gpt4AllJBackend:
+		return []interface{}{&gpt4all.PredictOptions{}}, true
+	case model.Gpt2Backend, model.GPTNeoXBackend, model.ReplitBackend, model.StarcoderBackend, model.RedPajamaBackend, model.StableLMBackend, model.DollyBackend:
+		return []interface{}{&gpt2.PredictOptions{}}, true
+	}
+	return nil, false
+}
+
+// modelBackend returns a backend of the family of the loaded model, to check
+// the backend options of the models whose backend was guessed. It is empty
+// for the backends not supporting them.
+func modelBackend(inferenceModel interface{}) string {
+	switch inferenceModel.(type) {
+	case *llama.LLama:
+		return model.LlamaBackend
+	case *gpt4all.Model:
+		return model.Gpt4AllJBackend
+	case *gpt2.GPT2, *gpt2.GPTNeoX, *gpt2.Replit, *gpt2.Starcoder, *gpt2.RedPajama, *gpt2.StableLM, *gpt2.Dolly:
+		return model.Gpt2Backend
+	}
+	return ""
+}
+
+// checkBackendOptions returns an error if some backend options don't match
+// any setting of the backend. Without a backend, the options must match the
+// settings of one of the backends supporting them.
+func checkBackendOptions(backend string, options map[string]interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	var targets []interface{}
+	if backend == "" {
+		for _, b := range []string{model.LlamaBackend, model.Gpt4AllJBackend, model.Gpt2Backend} {
+			t, _ := backendOptionsTargets(b)
+			targets = append(targets, t...)
+		}
+	} else {
+		var supported bool
+		if targets, supported = backendOptionsTargets(backend); !supported {
+			return fmt.Errorf("the %s backend doesn't support backend options", backend)
+		}
+	}
+
+	unknown := []string{}
+	for k, v := range options {
+		found := false
+		for _, t := range targets {
+			if field, exists := optionField(reflect.ValueOf(t).Elem(), k); exists {
+				if err := setOption(field, k, v); err != nil {
+					return err
+				}
+				found = true
+			}
+		}
+		if !found {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown backend options: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// environmentMu is held for writing by the loads setting environment
+// variables, and for reading by the other loads and by the inferences, which
+// don't see the variables meanwhile
+var environmentMu sync.RWMutex
+
+// withEnvironment runs load with the environment variables of the model
+// config set. The backends run in process and the environment is the one of
+// the process, so the variables are restored once the model is loaded, and
+// the other loads and inferences wait for it.
+func withEnvironment(env map[string]string, load func() error) error {
+	if len(env) == 0 {
+		environmentMu.RLock()
+		defer environmentMu.RUnlock()
+		return load()
+	}
+
+	environmentMu.Lock()
+	defer environmentMu.Unlock()
+
+	for k, v := range env {
+		previous, set := os.LookupEnv(k)
+		if err := os.Setenv(k, v); err != nil {
+			return fmt.Errorf("cannot set environment variable %s: %w", k, err)
+		}
+		if set {
+			defer os.Setenv(k, previous)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+	return load()
+}
+
+func llamaModelOptions(c Config) llama.ModelOption {
+	return func(p *llama.ModelOptions) {
+		// validated by checkBackendOptions
+		setOptions(p, c.BackendOptions)
+	}
+}
+
+func llamaPredictOptions(c Config) llama.PredictOption {
+	return func(p *llama.PredictOptions) {
+		setOptions(p, c.BackendOptions)
+	}
+}
+
+func gpt4allPredictOptions(c Config) gpt4all.PredictOption {
+	return func(p *gpt4all.PredictOptions) {
+		setOptions(p, c.BackendOptions)
+	}
+}
+
+func gpt2PredictOptions(c Config) gpt2.PredictOption {
+	return func(p *gpt2.PredictOptions) {
+		setOptions(p, c.BackendOptions)
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"os"
+	"reflect"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	llama "github.com/go-skynet/go-llama.cpp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backend options", func() {
+	It("matches the keys with the fields ignoring case and underscores", func() {
+		options := reflect.ValueOf(&llama.PredictOptions{}).Elem()
+		field, exists := optionField(options, "typical_p")
+		Expect(exists).To(BeTrue())
+		Expect(field.Kind()).To(Equal(reflect.Float64))
+		_, exists = optionField(options, "TAIL_FREE_SAMPLING_Z")
+		Expect(exists).To(BeTrue())
+		_, exists = optionField(options, "typical")
+		Expect(exists).To(BeFalse())
+	})
+	It("sets the options of the compatible types", func() {
+		options := llama.PredictOptions{}
+		Expect(setOptions(&options, map[string]interface{}{
+			"typical_p":  0.9,
+			"n_keep":     32,
+			"ignore_eos": true,
+			"logit_bias": "15043(+5)",
+			// meant for another options struct
+			"mlock": true,
+		})).To(Succeed())
+		Expect(options.TypicalP).To(Equal(0.9))
+		Expect(options.NKeep).To(Equal(32))
+		Expect(options.IgnoreEOS).To(BeTrue())
+		Expect(options.LogitBias).To(Equal("15043(+5)"))
+	})
+	It("rejects the values of other types", func() {
+		Expect(setOptions(&llama.PredictOptions{}, map[string]interface{}{"typical_p": "high"})).To(MatchError(ContainSubstring("expected a number")))
+		Expect(setOptions(&llama.PredictOptions{}, map[string]interface{}{"ignore_eos": 1})).To(MatchError(ContainSubstring("expected a bool")))
+		Expect(setOptions(&llama.PredictOptions{}, map[string]interface{}{"n_keep": 1.5})).To(MatchError(ContainSubstring("expected an integer")))
+		Expect(setOptions(&llama.PredictOptions{}, map[string]interface{}{"n_keep": nil})).To(MatchError(ContainSubstring("missing value")))
+	})
+	It("checks the options against the backend before loading", func() {
+		Expect(checkBackendOptions(model.LlamaBackend, nil)).To(Succeed())
+		Expect(checkBackendOptions(model.LlamaBackend, map[string]interface{}{"mlock": true, "typical_p": 0.9})).To(Succeed())
+		Expect(checkBackendOptions(model.LlamaBackend, map[string]interface{}{"mlock": true, "foo": 1, "bar": 2})).To(MatchError("unknown backend options: bar, foo"))
+		Expect(checkBackendOptions(model.Gpt2Backend, map[string]interface{}{"mlock": true})).To(MatchError("unknown backend options: mlock"))
+		Expect(checkBackendOptions(model.WhisperBackend, map[string]interface{}{"mlock": true})).To(MatchError(ContainSubstring("doesn't support backend options")))
+		// any backend could be guessed
+		Expect(checkBackendOptions("", map[string]interface{}{"mlock": true})).To(Succeed())
+		Expect(checkBackendOptions("", map[string]interface{}{"foo": 1})).To(MatchError("unknown backend options: foo"))
+	})
+	It("sets the environment only while loading", func() {
+		os.Setenv("LOCALAI_TEST_SET", "before")
+		DeferCleanup(os.Unsetenv, "LOCALAI_TEST_SET")
+
+		env := map[string]string{"LOCALAI_TEST_SET": "load", "LOCALAI_TEST_UNSET": "load"}
+		Expect(withEnvironment(env, func() error {
+			Expect(os.Getenv("LOCALAI_TEST_SET")).To(Equal("load"))
+			Expect(os.Getenv("LOCALAI_TEST_UNSET")).To(Equal("load"))
+			return nil
+		})).To(Succeed())
+		Expect(os.Getenv("LOCALAI_TEST_SET")).To(Equal("before"))
+		_, set := os.LookupEnv("LOCALAI_TEST_UNSET")
+		Expect(set).To(BeFalse())
+	})
+	It("holds the other loads while the environment is set", func() {
+		loading, release := make(chan struct{}), make(chan struct{})
+		go withEnvironment(map[string]string{"LOCALAI_TEST_HELD": "load"}, func() error {
+			close(loading)
+			<-release
+			return nil
+		})
+		<-loading
+
+		var seen string
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			withEnvironment(nil, func() error {
+				seen = os.Getenv("LOCALAI_TEST_HELD")
+				return nil
+			})
+		}()
+		Consistently(done, "100ms").ShouldNot(BeClosed())
+		close(release)
+		Eventually(done).Should(BeClosed())
+		Expect(seen).To(BeEmpty())
+	})
+})
@@ -0,0 +1,416 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+// BridgeConfig serves the API over MQTT or NATS: the requests published on
+// Topic are answered on ResponseTopic
+type BridgeConfig struct {
+	// Broker is the address of the MQTT broker, e.g. tcp://localhost:1883,
+	// or of the NATS server, e.g. nats://localhost:4222
+	Broker        string
+	Topic         string
+	ResponseTopic string
+	ClientID      string
+	Username      string
+	Password      string
+	// Workers is the number of requests served at once, 4 if 0. As many
+	// wait their turn, the others are answered with a 429 status.
+	Workers int
+}
+
+const defaultBridgeWorkers = 4
+
+// the endpoints reachable over MQTT
+var bridgeEndpoints = map[string]bool{
+	"completions":          true,
+	"chat/completions":     true,
+	"edits":                true,
+	"embeddings":           true,
+	"audio/transcriptions": true,
+}
+
+// bridgeRequest is the payload of a request message
+type bridgeRequest struct {
+	// ID is copied to the response, to match them
+	ID string `json:"id"`
+	// Endpoint is the API endpoint, e.g. "chat/completions"
+	Endpoint string `json:"endpoint"`
+	// Request is the body of the request, as sent to the HTTP API
+	Request json.RawMessage `json:"request"`
+	APIKey  string          `json:"api_key"`
+	// ResponseTopic overrides the topic of the response, under the response
+	// topic of the bridge only
+	ResponseTopic string `json:"response_topic"`
+
+	// Audio is the base64 encoded audio file to transcribe
+	Audio []byte `json:"audio"`
+	// FileName is the name of the audio file, its extension tells the format
+	FileName string `json:"file_name"`
+}
+
+type bridgeResponse struct {
+	ID string `json:"id,omitempty"`
+	// Status is the HTTP status code the API would have returned
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// bridgeMessage is a message received by the bridge
+type bridgeMessage struct {
+	payload []byte
+	// reply is the subject the publisher waits for the response on, with
+	// the NATS requests
+	reply string
+}
+
+// bridgeTransport is the connection of the bridge to the broker. It
+// reconnects on its own when the connection is lost.
+type bridgeTransport interface {
+	// connect subscribes to topic, handle is called with its messages and
+	// must not block
+	connect(topic string, handle func(bridgeMessage)) error
+	publish(topic string, payload []byte) error
+	// remoteAddr is the address of the broker, the requests come from
+	remoteAddr() net.Addr
+	close()
+}
+
+func newBridgeTransport(config BridgeConfig) (bridgeTransport, error) {
+	u, err := url.Parse(config.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid broker address: %w", err)
+	}
+	if u.Scheme == "nats" {
+		return &natsTransport{config: config}, nil
+	}
+	return &mqttTransport{config: config, host: u.Hostname()}, nil
+}
+
+type mqttTransport struct {
+	config BridgeConfig
+	client paho.Client
+	// host is the broker host, resolved on connection
+	host string
+
+	mu   sync.Mutex
+	addr net.Addr
+}
+
+func (t *mqttTransport) connect(topic string, handle func(bridgeMessage)) error {
+	opts := paho.NewClientOptions().
+		AddBroker(t.config.Broker).
+		SetClientID(t.config.ClientID).
+		SetUsername(t.config.Username).
+		SetPassword(t.config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Error().Msgf("MQTT bridge disconnected: %s", err.Error())
+		}).
+		// the subscriptions don't survive the reconnections
+		SetOnConnectHandler(func(c paho.Client) {
+			t.resolve()
+			token := c.Subscribe(topic, 0, func(_ paho.Client, m paho.Message) {
+				handle(bridgeMessage{payload: m.Payload()})
+			})
+			if token.Wait() && token.Error() != nil {
+				log.Error().Msgf("MQTT bridge: error subscribing to %s: %s", topic, token.Error().Error())
+				return
+			}
+			log.Info().Msgf("MQTT bridge listening on %s", topic)
+		})
+	t.client = paho.NewClient(opts)
+	// retried in the background until connected
+	t.client.Connect()
+	return nil
+}
+
+// resolve looks the address of the broker up
+func (t *mqttTransport) resolve() {
+	var addr net.Addr = &net.TCPAddr{IP: net.IPv4zero}
+	if ips, err := net.LookupIP(t.host); err == nil && len(ips) > 0 {
+		addr = &net.TCPAddr{IP: ips[0]}
+	}
+	t.mu.Lock()
+	t.addr = addr
+	t.mu.Unlock()
+}
+
+func (t *mqttTransport) publish(topic string, payload []byte) error {
+	token := t.client.Publish(topic, 0, false, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timeout")
+	}
+	return token.Error()
+}
+
+func (t *mqttTransport) remoteAddr() net.Addr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.addr
+}
+
+func (t *mqttTransport) close() {
+	t.client.Disconnect(250)
+}
+
+type natsTransport struct {
+	config BridgeConfig
+	conn   *nats.Conn
+}
+
+func (t *natsTransport) connect(topic string, handle func(bridgeMessage)) error {
+	opts := []nats.Option{
+		nats.Name(t.config.ClientID),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(5 * time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Error().Msgf("NATS bridge disconnected: %s", err.Error())
+			}
+		}),
+	}
+	if t.config.Username != "" {
+		opts = append(opts, nats.UserInfo(t.config.Username, t.config.Password))
+	}
+	conn, err := nats.Connect(t.config.Broker, opts...)
+	if err != nil {
+		return err
+	}
+	// kept across the reconnections
+	if _, err := conn.Subscribe(topic, func(m *nats.Msg) {
+		handle(bridgeMessage{payload: m.Data, reply: m.Reply})
+	}); err != nil {
+		conn.Close()
+		return err
+	}
+	t.conn = conn
+	log.Info().Msgf("NATS bridge listening on %s", topic)
+	return nil
+}
+
+func (t *natsTransport) publish(topic string, payload []byte) error {
+	return t.conn.Publish(topic, payload)
+}
+
+func (t *natsTransport) remoteAddr() net.Addr {
+	addr, err := net.ResolveTCPAddr("tcp", t.conn.ConnectedAddr())
+	if err != nil {
+		return &net.TCPAddr{IP: net.IPv4zero}
+	}
+	return addr
+}
+
+func (t *natsTransport) close() {
+	t.conn.Close()
+}
+
+type bridge struct {
+	config    BridgeConfig
+	handler   fasthttp.RequestHandler
+	transport bridgeTransport
+}
+
+// run serves the requests published on the topic until the context is
+// canceled, by a pool of workers
+func (b *bridge) run(ctx context.Context) {
+	if b.transport == nil {
+		t, err := newBridgeTransport(b.config)
+		if err != nil {
+			log.Error().Msgf("bridge: %s", err.Error())
+			return
+		}
+		b.transport = t
+	}
+
+	workers := b.config.Workers
+	if workers <= 0 {
+		workers = defaultBridgeWorkers
+	}
+	queue := make(chan bridgeMessage, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case m := <-queue:
+					b.handle(m)
+				}
+			}
+		}()
+	}
+
+	err := b.transport.connect(b.config.Topic, func(m bridgeMessage) {
+		select {
+		case queue <- m:
+		default:
+			// the broker is not held while the workers are busy
+			req := bridgeRequest{}
+			json.Unmarshal(m.payload, &req)
+			b.respond(m, req, fiber.StatusTooManyRequests, errorBody(fiber.StatusTooManyRequests, "too many requests"))
+		}
+	})
+	if err != nil {
+		log.Error().Msgf("bridge: error connecting to %s: %s", b.config.Broker, err.Error())
+		return
+	}
+	<-ctx.Done()
+	b.transport.close()
+}
+
+func (b *bridge) handle(m bridgeMessage) {
+	req := bridgeRequest{}
+	status, body := fiber.StatusBadRequest, []byte(nil)
+	if err := json.Unmarshal(m.payload, &req); err != nil {
+		body = errorBody(status, fmt.Sprintf("invalid request: %s", err.Error()))
+	} else if _, err := b.responseTopic(m, req); err != nil {
+		body = errorBody(status, err.Error())
+	} else {
+		status, body = b.do(req)
+	}
+	b.respond(m, req, status, body)
+}
+
+// natsInbox is the prefix of the reply subjects of the NATS clients
+const natsInbox = "_INBOX."
+
+// responseTopic returns the topic of the request, or the reply subject of the
+// message, or else the response topic. The publishers can't send the
+// responses elsewhere than under the response topic, or to a NATS inbox.
+func (b *bridge) responseTopic(m bridgeMessage, req bridgeRequest) (string, error) {
+	switch {
+	case req.ResponseTopic != "":
+		if req.ResponseTopic != b.config.ResponseTopic && !strings.HasPrefix(req.ResponseTopic, b.config.ResponseTopic+"/") {
+			return "", fmt.Errorf("response_topic must be under %s", b.config.ResponseTopic)
+		}
+		return req.ResponseTopic, nil
+	case m.reply != "":
+		if !strings.HasPrefix(m.reply, natsInbox) {
+			return "", fmt.Errorf("the reply subject must be under %s", natsInbox)
+		}
+		return m.reply, nil
+	}
+	return b.config.ResponseTopic, nil
+}
+
+// respond publishes the response on its topic, on the response topic if the
+// request asked for another one
+func (b *bridge) respond(m bridgeMessage, req bridgeRequest, status int, body []byte) {
+	topic, err := b.responseTopic(m, req)
+	if err != nil {
+		topic = b.config.ResponseTopic
+	}
+	res, err := json.Marshal(bridgeResponse{ID: req.ID, Status: status, Response: body})
+	if err != nil {
+		log.Error().Msgf("bridge: %s", err.Error())
+		return
+	}
+	if err := b.transport.publish(topic, res); err != nil {
+		log.Error().Msgf("bridge: error publishing the response %s: %s", req.ID, err.Error())
+	}
+}
+
+// do runs the request through the API, as an HTTP request from the broker:
+// the IPs allowed and denied apply to its address
+func (b *bridge) do(req bridgeRequest) (int, []byte) {
+	if !bridgeEndpoints[req.Endpoint] {
+		return fiber.StatusNotFound, errorBody(fiber.StatusNotFound, fmt.Sprintf("unsupported endpoint %q", req.Endpoint))
+	}
+
+	input := map[string]interface{}{}
+	if len(req.Request) > 0 {
+		if err := json.Unmarshal(req.Request, &input); err != nil {
+			return fiber.StatusBadRequest, errorBody(fiber.StatusBadRequest, fmt.Sprintf("invalid request: %s", err.Error()))
+		}
+	}
+	// the responses are published whole
+	delete(input, "stream")
+
+	var body []byte
+	var contentType string
+	var err error
+	if req.Endpoint == "audio/transcriptions" {
+		body, contentType, err = transcriptionForm(input, req.Audio, req.FileName)
+	} else {
+		contentType = fiber.MIMEApplicationJSON
+		body, err = json.Marshal(input)
+	}
+	if err != nil {
+		return fiber.StatusBadRequest, errorBody(fiber.StatusBadRequest, err.Error())
+	}
+
+	conn := &handlerConn{
+		local:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		remote: &net.TCPAddr{IP: net.IPv4zero},
+		closed: make(chan struct{}),
+	}
+	if addr := b.transport.remoteAddr(); addr != nil {
+		conn.remote = addr
+	}
+	var ctx fasthttp.RequestCtx
+	ctx.Init2(conn, nil, true)
+	ctx.Request.Header.SetMethod(fiber.MethodPost)
+	ctx.Request.SetRequestURI("/v1/" + req.Endpoint)
+	ctx.Request.Header.SetContentType(contentType)
+	if req.APIKey != "" {
+		ctx.Request.Header.Set(fiber.HeaderAuthorization, "Bearer "+req.APIKey)
+	}
+	ctx.Request.SetBody(body)
+
+	b.handler(&ctx)
+
+	return ctx.Response.StatusCode(), append([]byte{}, ctx.Response.Body()...)
+}
+
+func transcriptionForm(input map[string]interface{}, audio []byte, fileName string) ([]byte, string, error) {
+	if len(audio) == 0 {
+		return nil, "", fmt.Errorf("audio is required")
+	}
+	if fileName == "" {
+		fileName = "audio.wav"
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range input {
+		if err := w.WriteField(k, fmt.Sprint(v)); err != nil {
+			return nil, "", err
+		}
+	}
+	f, err := w.CreateFormFile("file", fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := f.Write(audio); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), w.FormDataContentType(), nil
+}
+
+func errorBody(code int, message string) []byte {
+	body, _ := json.Marshal(ErrorResponse{Error: &APIError{Message: message, Code: code}})
+	return body
+}
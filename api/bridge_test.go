@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/valyala/fasthttp"
+)
+
+// testTransport delivers the messages published by the tests, and records
+// the responses
+type testTransport struct {
+	handle    func(bridgeMessage)
+	connected chan struct{}
+
+	mu        sync.Mutex
+	responses []bridgeResponse
+}
+
+func (t *testTransport) connect(topic string, handle func(bridgeMessage)) error {
+	t.handle = handle
+	close(t.connected)
+	return nil
+}
+
+func (t *testTransport) publish(topic string, payload []byte) error {
+	res := bridgeResponse{}
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.responses = append(t.responses, res)
+	return nil
+}
+
+func (t *testTransport) statuses() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	statuses := map[string]int{}
+	for _, res := range t.responses {
+		statuses[res.ID] = res.Status
+	}
+	return statuses
+}
+
+func (t *testTransport) remoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 1, 2, 3)}
+}
+
+func (t *testTransport) close() {}
+
+var _ = Describe("Bridge", func() {
+	It("serves as many requests at once as workers, and queues as many", func() {
+		release := make(chan struct{})
+		var mu sync.Mutex
+		served := 0
+		transport := &testTransport{connected: make(chan struct{})}
+		b := &bridge{
+			config: BridgeConfig{Topic: "requests", ResponseTopic: "responses", Workers: 2},
+			handler: func(ctx *fasthttp.RequestCtx) {
+				mu.Lock()
+				served++
+				mu.Unlock()
+				<-release
+				ctx.SetStatusCode(fiber.StatusOK)
+				ctx.SetBodyString("{}")
+			},
+			transport: transport,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.run(ctx)
+		Eventually(transport.connected).Should(BeClosed())
+
+		publish := func(i int) {
+			transport.handle(bridgeMessage{payload: []byte(fmt.Sprintf(`{"id":"%d","endpoint":"completions"}`, i))})
+		}
+		publish(0)
+		publish(1)
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return served
+		}).Should(Equal(2))
+		publish(2)
+		publish(3)
+		publish(4)
+		Expect(transport.statuses()).To(Equal(map[string]int{"4": fiber.StatusTooManyRequests}))
+
+		close(release)
+		Eventually(transport.statuses).Should(HaveLen(5))
+		Expect(transport.statuses()).To(Equal(map[string]int{
+			"0": fiber.StatusOK, "1": fiber.StatusOK, "2": fiber.StatusOK, "3": fiber.StatusOK, "4": fiber.StatusTooManyRequests,
+		}))
+	})
+
+	It("answers under the response topic only", func() {
+		transport := &testTransport{}
+		var served []string
+		b := &bridge{
+			config: BridgeConfig{ResponseTopic: "responses"},
+			handler: func(ctx *fasthttp.RequestCtx) {
+				served = append(served, string(ctx.Path()))
+				ctx.SetBodyString("{}")
+			},
+			transport: transport,
+		}
+		var topics []string
+		topic := func(m bridgeMessage) {
+			b.handle(m)
+			req := bridgeRequest{}
+			json.Unmarshal(m.payload, &req)
+			t, err := b.responseTopic(m, req)
+			if err != nil {
+				t = "rejected"
+			}
+			topics = append(topics, t)
+		}
+
+		topic(bridgeMessage{payload: []byte(`{"id":"1","endpoint":"completions","response_topic":"responses/kitchen"}`)})
+		topic(bridgeMessage{payload: []byte(`{"id":"2","endpoint":"completions"}`), reply: "_INBOX.abc"})
+		topic(bridgeMessage{payload: []byte(`{"id":"3","endpoint":"completions","response_topic":"lights/on"}`)})
+		topic(bridgeMessage{payload: []byte(`{"id":"4","endpoint":"completions","response_topic":"responsesx"}`)})
+		topic(bridgeMessage{payload: []byte(`{"id":"5","endpoint":"completions"}`), reply: "lights.on"})
+
+		Expect(topics).To(Equal([]string{"responses/kitchen", "_INBOX.abc", "rejected", "rejected", "rejected"}))
+		Expect(served).To(HaveLen(2))
+		Expect(transport.statuses()).To(Equal(map[string]int{
+			"1": fiber.StatusOK, "2": fiber.StatusOK, "3": fiber.StatusBadRequest, "4": fiber.StatusBadRequest, "5": fiber.StatusBadRequest,
+		}))
+	})
+
+	It("runs the requests from the address of the broker", func() {
+		var remote string
+		b := &bridge{
+			handler: func(ctx *fasthttp.RequestCtx) {
+				remote = ctx.RemoteIP().String()
+			},
+			transport: &testTransport{},
+		}
+		b.do(bridgeRequest{Endpoint: "completions", Request: json.RawMessage(`{}`)})
+		Expect(remote).To(Equal("10.1.2.3"))
+	})
+})
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// ChaosConfig configures the faults injected in the API responses. It is meant
+// to be used only for testing the resilience of the clients.
+type ChaosConfig struct {
+	// Latency is the maximum random delay added before handling each request
+	Latency time.Duration
+	// ErrorRate is the probability (0-1) that a request fails with 503
+	ErrorRate float64
+	// DisconnectRate is the probability (0-1) that a streamed response is cut
+	DisconnectRate float64
+	// DisconnectAfter is the maximum time before a streamed response is cut
+	DisconnectAfter time.Duration
+}
+
+func chaosMiddleware(cfg ChaosConfig) fiber.Handler {
+	log.Warn().Msgf("Chaos mode enabled: %+v", cfg)
+
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	random := func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Float64()
+	}
+
+	return func(c *fiber.Ctx) error {
+		if cfg.Latency > 0 {
+			time.Sleep(time.Duration(random() * float64(cfg.Latency)))
+		}
+
+		if random() < cfg.ErrorRate {
+			log.Debug().Msgf("Chaos: injecting error on %s", c.Path())
+			return fiber.NewError(fiber.StatusServiceUnavailable, "chaos: injected failure")
+		}
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if c.Context().Response.IsBodyStream() && random() < cfg.DisconnectRate {
+			after := time.Duration(random() * float64(cfg.DisconnectAfter))
+			log.Debug().Msgf("Chaos: dropping the connection of %s in %s", c.Path(), after)
+			conn := c.Context().Conn()
+			time.AfterFunc(after, func() {
+				conn.Close()
+			})
+		}
+		return nil
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// default maximum number of tokens generated for a label
+const classificationMaxTokens = 16
+
+const defaultClassificationPrompt = `Classify the following text into one of these categories: %s.
+Answer only with the category.
+
+Text: %s
+
+Category:`
+
+type ClassificationRequest struct {
+	Labels []string `json:"labels"`
+}
+
+type ClassificationItem struct {
+	Index int    `json:"index"`
+	Label string `json:"label"`
+	// Scores is the share of the n generations choosing each label. With a
+	// single generation it is 1 for the chosen label and 0 for the others
+	Scores map[string]float64 `json:"scores"`
+	Object string             `json:"object"`
+}
+
+type ClassificationResponse struct {
+	Object string               `json:"object"`
+	Model  string               `json:"model,omitempty"`
+	Data   []ClassificationItem `json:"data"`
+}
+
+// normalizeAnswer drops the leading blanks and the case of a generated answer
+func normalizeAnswer(s string) string {
+	return strings.ToLower(strings.TrimLeft(s, " \t\n"))
+}
+
+// matchLabel returns the longest label the generated text starts with, or an
+// empty string if the model answered with none of the labels.
+func matchLabel(prediction string, labels []string) string {
+	prediction = normalizeAnswer(prediction)
+
+	match := ""
+	for _, l := range labels {
+		if strings.HasPrefix(prediction, strings.ToLower(l)) && len(l) > len(match) {
+			match = l
+		}
+	}
+	return match
+}
+
+// scoreLabels returns the label most of the generations agree on, and the
+// share of the generations choosing each label
+func scoreLabels(choices []Choice, labels []string) (string, map[string]float64) {
+	votes := map[string]int{}
+	for _, ch := range choices {
+		votes[matchLabel(ch.Text, labels)]++
+	}
+
+	label, best := "", 0
+	scores := map[string]float64{}
+	for _, l := range labels {
+		if votes[l] > best {
+			label, best = l, votes[l]
+		}
+		scores[l] = 0
+		if len(choices) > 0 {
+			scores[l] = float64(votes[l]) / float64(len(choices))
+		}
+	}
+	return label, scores
+}
+
+// labelConstraint constrains a generation to the label set: it stops the
+// generation as soon as the text can't be completed into a label anymore, or
+// once it is a label no other label continues.
+type labelConstraint struct {
+	labels []string
+	text   string
+}
+
+// token is the token callback of the generation
+func (l *labelConstraint) token(s string) bool {
+	l.text += s
+	answer := normalizeAnswer(l.text)
+	if answer == "" {
+		return true
+	}
+
+	for _, label := range l.labels {
+		label = strings.ToLower(label)
+		// the answer can still become this label, or a longer one
+		if len(answer) < len(label) && strings.HasPrefix(label, answer) {
+			return true
+		}
+	}
+	return false
+}
+
+// reset prepares the constraint for the next generation
+func (l *labelConstraint) reset() {
+	l.text = ""
+}
+
+// classificationEndpoint turns an instruct model into a classifier: the model
+// is asked to pick one of the labels, and the generation is stopped as soon as
+// it leaves the label set. The scores are the share of the n generations
+// choosing each label.
+func classificationEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, threads, ctx int, f16 bool) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		config, input, err := readConfig(cm, c, loader, debug, threads, ctx, f16)
+		if err != nil {
+			return fmt.Errorf("failed reading parameters from request:%w", err)
+		}
+
+		req := new(ClassificationRequest)
+		if err := c.BodyParser(req); err != nil {
+			return err
+		}
+
+		if len(req.Labels) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "labels are required")
+		}
+
+		// A label is short, don't let the model ramble
+		if input.Maxtokens == 0 {
+			config.Maxtokens = classificationMaxTokens
+		}
+		config.StopWords = append(config.StopWords, "\n")
+
+		log.Debug().Msgf("Parameter Config: %+v", config)
+
+		items := []ClassificationItem{}
+		for i, text := range config.InputStrings {
+			predInput := fmt.Sprintf(defaultClassificationPrompt, strings.Join(req.Labels, ", "), text)
+			if config.TemplateConfig.Classification != "" {
+				templatedInput, err := loader.TemplatePrefix(config.TemplateConfig.Classification, struct {
+					Input  string
+					Labels []string
+				}{Input: text, Labels: req.Labels})
+				if err == nil {
+					predInput = templatedInput
+					log.Debug().Msgf("Template found, input modified to: %s", predInput)
+				}
+			}
+
+			constraint := &labelConstraint{labels: req.Labels}
+			choices, err := ComputeChoices(predInput, input, config, loader, func(s string, c *[]Choice) {
+				*c = append(*c, Choice{Text: s})
+				constraint.reset()
+			}, constraint.token)
+			if err != nil {
+				return err
+			}
+
+			item := ClassificationItem{Index: i, Object: "classification"}
+			item.Label, item.Scores = scoreLabels(choices, req.Labels)
+			items = append(items, item)
+		}
+
+		return c.JSON(ClassificationResponse{
+			Object: "list",
+			Model:  input.Model,
+			Data:   items,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Classification", func() {
+	labels := []string{"positive", "negative", "very positive"}
+
+	It("matches the label the answer starts with", func() {
+		Expect(matchLabel(" Positive.", labels)).To(Equal("positive"))
+		Expect(matchLabel("very positive", labels)).To(Equal("very positive"))
+		Expect(matchLabel("The text is positive", labels)).To(BeEmpty())
+		Expect(matchLabel("", labels)).To(BeEmpty())
+	})
+	It("stops the generation once it leaves the label set", func() {
+		c := &labelConstraint{labels: labels}
+		Expect(c.token(" ")).To(BeTrue())
+		Expect(c.token("The")).To(BeFalse())
+	})
+	It("stops the generation on a complete label", func() {
+		c := &labelConstraint{labels: labels}
+		Expect(c.token(" Neg")).To(BeTrue())
+		Expect(c.token("ative")).To(BeFalse())
+		Expect(matchLabel(c.text, labels)).To(Equal("negative"))
+	})
+	It("goes on while a longer label can follow", func() {
+		c := &labelConstraint{labels: []string{"pos", "positive"}}
+		Expect(c.token("pos")).To(BeTrue())
+		Expect(c.token("itive")).To(BeFalse())
+		Expect(matchLabel(c.text, c.labels)).To(Equal("positive"))
+
+		c.reset()
+		Expect(c.token("pos")).To(BeTrue())
+		Expect(c.token(".")).To(BeFalse())
+		Expect(matchLabel(c.text, c.labels)).To(Equal("pos"))
+	})
+	It("scores the labels of a single generation", func() {
+		label, scores := scoreLabels([]Choice{{Text: "negative"}}, labels)
+		Expect(label).To(Equal("negative"))
+		Expect(scores).To(Equal(map[string]float64{"positive": 0, "negative": 1, "very positive": 0}))
+
+		label, scores = scoreLabels([]Choice{{Text: "The text is positive"}}, labels)
+		Expect(label).To(BeEmpty())
+		Expect(scores).To(Equal(map[string]float64{"positive": 0, "negative": 0, "very positive": 0}))
+	})
+	It("scores the share of the generations choosing each label", func() {
+		label, scores := scoreLabels([]Choice{{Text: "positive"}, {Text: "negative"}, {Text: "positive"}, {Text: "maybe"}}, labels)
+		Expect(label).To(Equal("positive"))
+		Expect(scores).To(Equal(map[string]float64{"positive": 0.5, "negative": 0.25, "very positive": 0}))
+	})
+})
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	model "github.com/go-skynet/LocalAI/pkg/model"
 	"github.com/gofiber/fiber/v2"
@@ -31,18 +34,92 @@ type Config struct {
 	MirostatETA    float64           `yaml:"mirostat_eta"`
 	MirostatTAU    float64           `yaml:"mirostat_tau"`
 	Mirostat       int               `yaml:"mirostat"`
+	Retry          RetryConfig       `yaml:"retry"`
+
+	// BackendOptions are passed as they are to the options of the backend
+	BackendOptions map[string]interface{} `yaml:"backend_options"`
+	// Environment variables set while the model loads. They are the
+	// environment of the process, not isolated per model
+	Environment map[string]string `yaml:"environment"`
+
+	// Description, License and URL (where the model comes from) are listed
+	// with the models
+	Description string `yaml:"description"`
+	License     string `yaml:"license"`
+	URL         string `yaml:"url"`
+	// NonCommercial marks the model as not for commercial use, when the
+	// license doesn't tell it (e.g. "CC-BY-NC-4.0" does)
+	NonCommercial bool `yaml:"non_commercial"`
+	// LicenseAcknowledged allows serving a non-commercial model, when the
+	// loader requires it
+	LicenseAcknowledged bool `yaml:"license_acknowledged"`
+	// SHA256 is the checksum of the model file, verified by the integrity checks
+	SHA256 string `yaml:"sha256"`
 
 	PromptStrings, InputStrings []string
 	InputToken                  [][]int
+	// systemPrompt is the prompt of the library referenced by the request,
+	// the system message of chats
+	systemPrompt string
+
+	stats *requestStats
+	// seedIgnored is set once a backend ignoring the seed generated, shared
+	// by the copies of the config
+	seedIgnored *atomic.Bool
+	// ctx is the context of the request, canceled when the client is gone
+	// where the server tells it
+	ctx context.Context
 }
 
 type TemplateConfig struct {
 	Completion string `yaml:"completion"`
 	Chat       string `yaml:"chat"`
 	Edit       string `yaml:"edit"`
+
+	Classification string `yaml:"classification"`
+	Summarization  string `yaml:"summarization"`
+	Translation    string `yaml:"translation"`
+
+	// ResponseLanguage renders the instruction to answer in {{.Language}}
+	ResponseLanguage string `yaml:"response_language"`
+}
+
+// ConfigMerger holds the configs of the models. Read them with get and
+// snapshot, as the requests load them too
+type ConfigMerger struct {
+	mu      *sync.RWMutex
+	configs map[string]Config
+}
+
+func NewConfigMerger() ConfigMerger {
+	return ConfigMerger{mu: &sync.RWMutex{}, configs: make(map[string]Config)}
 }
 
-type ConfigMerger map[string]Config
+// get returns the config of the model name
+func (cm ConfigMerger) get(name string) (Config, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	c, exists := cm.configs[name]
+	return c, exists
+}
+
+// snapshot returns a copy of the configs, to range over them
+func (cm ConfigMerger) snapshot() map[string]Config {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	configs := make(map[string]Config, len(cm.configs))
+	for name, c := range cm.configs {
+		configs[name] = c
+	}
+	return configs
+}
+
+// set adds or replaces the config of c.Name
+func (cm ConfigMerger) set(c Config) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.configs[c.Name] = c
+}
 
 func ReadConfigFile(file string) ([]*Config, error) {
 	c := &[]*Config{}
@@ -53,6 +130,11 @@ func ReadConfigFile(file string) ([]*Config, error) {
 	if err := yaml.Unmarshal(f, c); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal config file: %w", err)
 	}
+	for _, cc := range *c {
+		if err := cc.validate(); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", cc.Name, err)
+		}
+	}
 
 	return *c, nil
 }
@@ -66,10 +148,18 @@ func ReadConfig(file string) (*Config, error) {
 	if err := yaml.Unmarshal(f, c); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal config file: %w", err)
 	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file: %w", err)
+	}
 
 	return c, nil
 }
 
+// validate checks the settings that would fail the requests, and prepares them
+func (c *Config) validate() error {
+	return c.Retry.compile()
+}
+
 func (cm ConfigMerger) LoadConfigFile(file string) error {
 	c, err := ReadConfigFile(file)
 	if err != nil {
@@ -77,7 +167,7 @@ func (cm ConfigMerger) LoadConfigFile(file string) error {
 	}
 
 	for _, cc := range c {
-		cm[cc.Name] = *cc
+		cm.set(*cc)
 	}
 	return nil
 }
@@ -88,7 +178,7 @@ func (cm ConfigMerger) LoadConfig(file string) error {
 		return fmt.Errorf("cannot read config file: %w", err)
 	}
 
-	cm[c.Name] = *c
+	cm.set(*c)
 	return nil
 }
 
@@ -104,9 +194,11 @@ func (cm ConfigMerger) LoadConfigs(path string) error {
 			continue
 		}
 		c, err := ReadConfig(filepath.Join(path, file.Name()))
-		if err == nil {
-			cm[c.Name] = *c
+		if err != nil {
+			log.Error().Msgf("skipping %s: %s", file.Name(), err.Error())
+			continue
 		}
+		cm.set(*c)
 	}
 
 	return nil
@@ -180,6 +272,34 @@ func updateConfig(config *Config, input *OpenAIRequest) {
 		config.MirostatTAU = input.MirostatTAU
 	}
 
+	if input.ResponseLanguage != "" {
+		config.ResponseLanguage = input.ResponseLanguage
+	}
+
+	if input.MaxTime != 0 {
+		config.MaxTime = input.MaxTime
+	}
+
+	if input.StreamOptions != nil {
+		config.StreamOptions = input.StreamOptions
+	}
+
+	if input.Dimensions != 0 {
+		config.Dimensions = input.Dimensions
+	}
+
+	if input.Normalize {
+		config.Normalize = input.Normalize
+	}
+
+	if input.Metadata {
+		config.Metadata = input.Metadata
+	}
+
+	if input.Resumable {
+		config.Resumable = input.Resumable
+	}
+
 	switch inputs := input.Input.(type) {
 	case string:
 		if inputs != "" {
@@ -219,6 +339,13 @@ func readConfig(cm ConfigMerger, c *fiber.Ctx, loader *model.ModelLoader, debug
 		return nil, nil, err
 	}
 
+	// the model and the parameters of the session are the defaults of its requests
+	if input.SessionID != "" {
+		if session, exists := sessions.lookup(input.SessionID, requestOwner(c)); exists {
+			session.defaults(input)
+		}
+	}
+
 	modelFile := input.Model
 
 	if c.Params("model") != "" {
@@ -233,8 +360,13 @@ func readConfig(cm ConfigMerger, c *fiber.Ctx, loader *model.ModelLoader, debug
 	bearer := strings.TrimLeft(c.Get("authorization"), "Bearer ")
 	bearerExists := bearer != "" && loader.ExistsInModelPath(bearer)
 
+	key := requestAPIKey(c)
+
 	// If no model was specified, take the first available
-	if modelFile == "" && !bearerExists {
+	if modelFile == "" && !bearerExists && key != nil && len(key.Models) > 0 {
+		modelFile = key.Models[0]
+		log.Debug().Msgf("No model specified, using the first allowed for the key: %s", modelFile)
+	} else if modelFile == "" && !bearerExists {
 		models, _ := loader.ListModels()
 		if len(models) > 0 {
 			modelFile = models[0]
@@ -251,6 +383,10 @@ func readConfig(cm ConfigMerger, c *fiber.Ctx, loader *model.ModelLoader, debug
 		modelFile = bearer
 	}
 
+	if key != nil && !key.allows(modelFile) {
+		return nil, nil, fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("model %s is not allowed for this api key", modelFile))
+	}
+
 	// Load a config file if present after the model name
 	modelConfig := filepath.Join(loader.ModelPath, modelFile+".yaml")
 	if _, err := os.Stat(modelConfig); err == nil {
@@ -260,7 +396,7 @@ func readConfig(cm ConfigMerger, c *fiber.Ctx, loader *model.ModelLoader, debug
 	}
 
 	var config *Config
-	cfg, exists := cm[modelFile]
+	cfg, exists := cm.get(modelFile)
 	if !exists {
 		config = &Config{
 			OpenAIRequest: defaultRequest(modelFile),
@@ -272,9 +408,14 @@ func readConfig(cm ConfigMerger, c *fiber.Ctx, loader *model.ModelLoader, debug
 	} else {
 		config = &cfg
 	}
+	cm.fileLicense(config)
 
 	// Set the parameters for the language model prediction
-	updateConfig(config, input)
+	if key != nil {
+		key.apply(config, input)
+	} else {
+		updateConfig(config, input)
+	}
 
 	// Don't allow 0 as setting
 	if config.Threads == 0 {
@@ -290,5 +431,33 @@ func readConfig(cm ConfigMerger, c *fiber.Ctx, loader *model.ModelLoader, debug
 		config.Debug = true
 	}
 
+	// Half the memory of the context, and keep the buffers of the prompt
+	// evaluation small
+	if loader.LowMemory {
+		config.F16 = true
+		if config.Batch == 0 || config.Batch > lowMemoryBatch {
+			config.Batch = lowMemoryBatch
+		}
+	}
+
+	// The referenced prompt is used as the prompt by completions, and as
+	// the system message by chat completions
+	if input.PromptRef != "" {
+		if input.Prompt != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "prompt and prompt_ref can't be used together")
+		}
+		prompt, err := newPromptLibrary(loader).render(input.PromptRef, input.PromptVariables)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.PromptStrings = []string{prompt}
+		config.systemPrompt = prompt
+	}
+
+	pinSeed(config)
+	config.stats = requestStatsFrom(c)
+	config.seedIgnored = new(atomic.Bool)
+	config.ctx = c.UserContext()
+
 	return config, input, nil
 }
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+// handlerConn stands for the client connection of the requests served
+// through net/http. Closing it aborts the response.
+type handlerConn struct {
+	net.Conn
+	local, remote net.Addr
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *handlerConn) LocalAddr() net.Addr  { return c.local }
+func (c *handlerConn) RemoteAddr() net.Addr { return c.remote }
+func (c *handlerConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// flushWriter flushes every write, for the streamed responses to reach the
+// client as they are generated
+type flushWriter struct {
+	w    http.ResponseWriter
+	conn *handlerConn
+}
+
+// errClientGone is returned writing the responses of the clients gone
+var errClientGone = errors.New("the client is gone")
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	select {
+	case <-f.conn.closed:
+		return 0, errClientGone
+	default:
+	}
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+// requestContextKey is the user value of the requests served through
+// net/http holding their context
+type requestContextKey struct{}
+
+// requestContextMiddleware makes the context of the requests served through
+// net/http their user context, canceled when the client is gone
+func requestContextMiddleware(c *fiber.Ctx) error {
+	if ctx, ok := c.Context().UserValue(requestContextKey{}).(context.Context); ok {
+		c.SetUserContext(ctx)
+	}
+	return c.Next()
+}
+
+// Handler returns the API as a net/http handler, to mount it in another
+// server. The management endpoints are included, unless served on a
+// separate admin address. Call Start to run the scheduled jobs and checks,
+// and the MQTT bridge.
+func (a *App) Handler() http.Handler {
+	handler := a.app.Handler()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn := &handlerConn{
+			local:  &net.TCPAddr{},
+			remote: &net.TCPAddr{},
+			closed: make(chan struct{}),
+		}
+		if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+			conn.remote = addr
+		}
+
+		// the client leaving aborts the response, and the generation
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-r.Context().Done():
+				conn.Close()
+			case <-done:
+			}
+		}()
+
+		var ctx fasthttp.RequestCtx
+		ctx.Init2(conn, nil, true)
+		ctx.SetUserValue(requestContextKey{}, r.Context())
+
+		ctx.Request.Header.SetMethod(r.Method)
+		ctx.Request.SetRequestURI(r.URL.RequestURI())
+		ctx.Request.Header.SetHost(r.Host)
+		for k, values := range r.Header {
+			for _, v := range values {
+				ctx.Request.Header.Add(k, v)
+			}
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ctx.Request.SetBody(body)
+
+		handler(&ctx)
+
+		ctx.Response.Header.VisitAll(func(k, v []byte) {
+			switch string(k) {
+			// hop-by-hop headers, handled by net/http
+			case fasthttp.HeaderConnection, fasthttp.HeaderTransferEncoding:
+			default:
+				w.Header().Add(string(k), string(v))
+			}
+		})
+		w.WriteHeader(ctx.Response.StatusCode())
+
+		if err := ctx.Response.BodyWriteTo(flushWriter{w: w, conn: conn}); err != nil {
+			log.Debug().Msgf("error writing the response: %s", err.Error())
+			if errors.Is(err, errClientGone) {
+				// let net/http drop the connection
+				panic(http.ErrAbortHandler)
+			}
+		}
+	})
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/go-skynet/LocalAI/pkg/schedule"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// IntegrityOK files match the checksum of their config
+	IntegrityOK = "ok"
+	// IntegrityUnverified files have no checksum in their config, and didn't
+	// change since the last check
+	IntegrityUnverified = "unverified"
+	// IntegrityCorrupted files don't match the checksum of their config, or
+	// changed on disk without being modified
+	IntegrityCorrupted = "corrupted"
+	// IntegrityIncomplete files have another size than their source
+	IntegrityIncomplete = "incomplete"
+	IntegrityMissing    = "missing"
+	IntegrityError      = "error"
+)
+
+// IntegrityConfig checks the model files on a cron schedule
+type IntegrityConfig struct {
+	// Schedule is the cron expression of the checks, e.g. "0 3 * * *". The
+	// checks only run on demand if empty
+	Schedule string
+	// AutoUpdate downloads the models updated at their source url
+	AutoUpdate bool
+}
+
+// ModelCheck is the result of the check of a model file
+type ModelCheck struct {
+	Model   string    `json:"model"`
+	File    string    `json:"file"`
+	Time    time.Time `json:"time"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	// Source is the url of the config, checked for updates
+	Source          string `json:"source,omitempty"`
+	UpdateAvailable bool   `json:"update_available"`
+	Updated         bool   `json:"updated"`
+}
+
+type integrityChecker struct {
+	config   IntegrityConfig
+	schedule *schedule.Cron
+	cm       ConfigMerger
+	loader   *model.ModelLoader
+
+	running sync.Mutex
+
+	mu      sync.Mutex
+	lastRun time.Time
+	results map[string]ModelCheck
+}
+
+func newIntegrityChecker(config IntegrityConfig, cm ConfigMerger, loader *model.ModelLoader) (*integrityChecker, error) {
+	ic := &integrityChecker{config: config, cm: cm, loader: loader, results: map[string]ModelCheck{}}
+	if config.Schedule != "" {
+		var err error
+		if ic.schedule, err = schedule.Parse(config.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid integrity check schedule: %w", err)
+		}
+	}
+	return ic, nil
+}
+
+// run checks the models on schedule, until the context is canceled
+func (ic *integrityChecker) run(ctx context.Context) {
+	for {
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+
+		if ic.schedule.Matches(time.Now()) {
+			ic.check(ctx)
+		}
+	}
+}
+
+// check checks all the models, unless a check is running already
+func (ic *integrityChecker) check(ctx context.Context) {
+	if !ic.running.TryLock() {
+		return
+	}
+	defer ic.running.Unlock()
+	ic.checkAll(ctx)
+}
+
+// checkAll checks all the models, the requests to their sources are
+// canceled with ctx
+func (ic *integrityChecker) checkAll(ctx context.Context) {
+	log.Info().Msg("Checking the models integrity")
+	start := time.Now()
+
+	// the files of the configs, from the config with a checksum if several
+	// use the same file, then the other files
+	configs := ic.cm.snapshot()
+	names := []string{}
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	models := map[string]Config{}
+	for _, name := range names {
+		cfg := configs[name]
+		if cfg.Model == "" {
+			continue
+		}
+		if existing, exists := models[cfg.Model]; !exists || (existing.SHA256 == "" && cfg.SHA256 != "") {
+			models[cfg.Model] = cfg
+		}
+	}
+	if files, err := ic.loader.ListModels(); err == nil {
+		for _, f := range files {
+			if _, exists := models[f]; !exists {
+				models[f] = Config{OpenAIRequest: OpenAIRequest{Model: f}}
+			}
+		}
+	}
+
+	ic.mu.Lock()
+	previous := ic.results
+	ic.mu.Unlock()
+
+	// the files removed are dropped from the results
+	results := map[string]ModelCheck{}
+	for file, cfg := range models {
+		var prev *ModelCheck
+		if p, checked := previous[file]; checked {
+			prev = &p
+		}
+		result := ic.checkModel(ctx, file, cfg, prev)
+		if result.Status != IntegrityOK && result.Status != IntegrityUnverified {
+			log.Error().Msgf("Model %s is %s: %s", file, result.Status, result.Error)
+		}
+		results[file] = result
+	}
+
+	ic.mu.Lock()
+	ic.results, ic.lastRun = results, start
+	ic.mu.Unlock()
+	log.Info().Msgf("Models integrity checked in %s", time.Since(start))
+}
+
+func (ic *integrityChecker) checkModel(ctx context.Context, file string, cfg Config, previous *ModelCheck) ModelCheck {
+	name := cfg.Name
+	if name == "" {
+		name = file
+	}
+	check := ModelCheck{Model: name, File: file, Time: time.Now(), Source: cfg.URL}
+	path := filepath.Join(ic.loader.ModelPath, file)
+
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		check.Status, check.Error = IntegrityMissing, "model file not found"
+	case err != nil:
+		check.Status, check.Error = IntegrityError, err.Error()
+	default:
+		check.Size, check.ModTime = info.Size(), info.ModTime()
+		if check.SHA256, err = fileChecksum(path); err != nil {
+			check.Status, check.Error = IntegrityError, err.Error()
+			break
+		}
+
+		switch {
+		case cfg.SHA256 != "" && !strings.EqualFold(cfg.SHA256, check.SHA256):
+			check.Status, check.Error = IntegrityCorrupted, fmt.Sprintf("checksum %s, expected %s", check.SHA256, cfg.SHA256)
+		case cfg.SHA256 != "":
+			check.Status = IntegrityOK
+		case previous != nil && previous.SHA256 != "" && previous.SHA256 != check.SHA256 &&
+			previous.Size == check.Size && previous.ModTime.Equal(check.ModTime):
+			check.Status, check.Error = IntegrityCorrupted, "the file changed since the last check, without being modified"
+		default:
+			check.Status = IntegrityUnverified
+		}
+	}
+
+	if cfg.URL == "" {
+		return check
+	}
+
+	update, size, err := checkSource(ctx, cfg.URL, check.ModTime)
+	if err != nil {
+		if check.Error == "" {
+			check.Error = err.Error()
+		}
+		return check
+	}
+	check.UpdateAvailable = update || check.Status == IntegrityMissing
+	if !update && size >= 0 && check.Status == IntegrityUnverified && size != check.Size {
+		check.Status, check.Error = IntegrityIncomplete, fmt.Sprintf("size %d, the source is %d", check.Size, size)
+	}
+
+	if check.UpdateAvailable && ic.config.AutoUpdate {
+		check.Updated, err = updateModel(ctx, ic.loader, file, cfg.URL, cfg.SHA256)
+		if err != nil {
+			check.Error = err.Error()
+		}
+	}
+	return check
+}
+
+// sourceClient checks the sources of the models, not to hang the checks on
+// the servers not answering
+var sourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// checkSource returns whether the file at url is newer than modTime, and
+// its size, -1 if unknown
+func checkSource(ctx context.Context, url string, modTime time.Time) (bool, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, -1, err
+	}
+	resp, err := sourceClient.Do(req)
+	if err != nil {
+		return false, -1, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, -1, fmt.Errorf("failed checking %s: %s", url, resp.Status)
+	}
+
+	lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	update := err == nil && lastModified.After(modTime)
+	return update, resp.ContentLength, nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (ic *integrityChecker) report() (time.Time, []ModelCheck) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	checks := []ModelCheck{}
+	for _, c := range ic.results {
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].File < checks[j].File })
+	return ic.lastRun, checks
+}
+
+// integrityReport returns the results of the last models check
+func integrityReport(ic *integrityChecker) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		lastRun, checks := ic.report()
+		res := struct {
+			LastRun *time.Time   `json:"last_run,omitempty"`
+			Models  []ModelCheck `json:"models"`
+		}{Models: checks}
+		if !lastRun.IsZero() {
+			res.LastRun = &lastRun
+		}
+		return c.JSON(res)
+	}
+}
+
+// runIntegrityCheck checks the models now, in the background, until ctx is
+// canceled
+func runIntegrityCheck(ctx context.Context, ic *integrityChecker) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if !ic.running.TryLock() {
+			return fiber.NewError(fiber.StatusConflict, "a check is running already")
+		}
+		go func() {
+			defer ic.running.Unlock()
+			ic.checkAll(ctx)
+		}()
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+}
+
+// integrityMetrics writes the results of the last models check
+func integrityMetrics(b *metrics, ic *integrityChecker) {
+	lastRun, checks := ic.report()
+
+	b.family("localai_model_integrity_ok", "gauge", "Whether the model file passed the last integrity check")
+	for _, check := range checks {
+		ok := 0.0
+		if check.Status == IntegrityOK || check.Status == IntegrityUnverified {
+			ok = 1
+		}
+		b.sample("localai_model_integrity_ok", ok, "model", check.Model, "file", check.File, "status", check.Status)
+	}
+	b.family("localai_model_update_available", "gauge", "Whether a newer version of the model is available at its source")
+	for _, check := range checks {
+		if check.Source == "" {
+			continue
+		}
+		update := 0.0
+		if check.UpdateAvailable && !check.Updated {
+			update = 1
+		}
+		b.sample("localai_model_update_available", update, "model", check.Model, "file", check.File)
+	}
+	if !lastRun.IsZero() {
+		b.family("localai_model_integrity_last_run_timestamp_seconds", "gauge", "Start time of the last models check")
+		b.sample("localai_model_integrity_last_run_timestamp_seconds", float64(lastRun.Unix()))
+	}
+}
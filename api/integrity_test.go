@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Integrity checks", func() {
+	It("stop waiting for the sources once canceled", func() {
+		hang := make(chan struct{})
+		source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-hang
+		}))
+		DeferCleanup(source.Close)
+		DeferCleanup(func() { close(hang) })
+
+		modelsPath := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(modelsPath, "model.bin"), []byte("hello"), 0600)).To(Succeed())
+		cm := NewConfigMerger()
+		cm.set(Config{Name: "model", URL: source.URL, OpenAIRequest: OpenAIRequest{Model: "model.bin"}})
+		ic, err := newIntegrityChecker(IntegrityConfig{}, cm, model.NewModelLoader(modelsPath))
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ic.check(ctx)
+		}()
+		Eventually(done, "5s").Should(BeClosed())
+
+		_, checks := ic.report()
+		Expect(checks).To(HaveLen(1))
+		Expect(checks[0].Status).To(Equal(IntegrityUnverified))
+		Expect(checks[0].Error).To(ContainSubstring("context deadline exceeded"))
+	})
+})
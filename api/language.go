@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/go-skynet/LocalAI/pkg/text"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultResponseLanguagePrompt = `Always answer in %s, whatever the language of the question.`
+
+// generations in another language than the response language are retried
+// up to this number of times, the last one is returned anyway
+const responseLanguageRetries = 2
+
+// the streamed answers are held until this many bytes are generated, to
+// check their language before sending them
+const responseLanguageSample = 120
+
+// responseLanguageInstruction returns the instruction to answer in the
+// response language, empty if none is set
+func responseLanguageInstruction(config *Config, loader *model.ModelLoader) string {
+	if config.ResponseLanguage == "" {
+		return ""
+	}
+
+	if config.TemplateConfig.ResponseLanguage != "" {
+		templated, err := loader.TemplatePrefix(config.TemplateConfig.ResponseLanguage, struct {
+			Language string
+		}{Language: config.ResponseLanguage})
+		if err == nil {
+			return templated
+		}
+	}
+	return fmt.Sprintf(defaultResponseLanguagePrompt, config.ResponseLanguage)
+}
+
+// withResponseLanguage prefixes a prompt with the response language
+// instruction, if any
+func withResponseLanguage(prompt string, config *Config, loader *model.ModelLoader) string {
+	if instruction := responseLanguageInstruction(config, loader); instruction != "" {
+		return instruction + "\n\n" + prompt
+	}
+	return prompt
+}
+
+// detectLanguage returns the language of text. It asks the model only if
+// the language is not one text.DetectLanguage knows
+func detectLanguage(s string, input *OpenAIRequest, config *Config, loader *model.ModelLoader) (string, error) {
+	if language := text.DetectLanguage(s); language != "" {
+		return language, nil
+	}
+
+	single := *input
+	single.N = 1
+
+	detectConfig := *config
+	detectConfig.Maxtokens = languageDetectionMaxTokens
+	detectConfig.StopWords = append([]string{"\n"}, config.StopWords...)
+
+	choices, err := computeChoices(fmt.Sprintf(defaultLanguageDetectionPrompt, s), &single, &detectConfig, loader, func(s string, c *[]Choice) {
+		*c = append(*c, Choice{Text: s})
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(strings.TrimSpace(choices[0].Text), " ."), nil
+}
+
+// inLanguage tells if s is not written in another language than the
+// requested one. The languages text.DetectLanguage doesn't recognize are not
+// checked, asking the model would double the cost of the generation
+func inLanguage(s, language string) bool {
+	if text.LanguageCode(language) == "" {
+		return true
+	}
+	detected := text.DetectLanguage(s)
+	if detected != "" && !sameLanguage(detected, language) {
+		log.Debug().Msgf("Answer in %s instead of %s", detected, language)
+		return false
+	}
+	return true
+}
+
+// sameLanguage compares the codes of the languages, given by their names or
+// their codes. The languages without a code never match
+func sameLanguage(a, b string) bool {
+	code := text.LanguageCode(a)
+	return code != "" && code == text.LanguageCode(b)
+}
+
+// retryInLanguage returns the config of a new attempt to generate an answer
+// in the response language. The n choices of the request use the n seeds
+// following the seed, the attempts use the next ones: choice i of attempt a
+// uses the seed + a*n + i
+func retryInLanguage(config *Config, attempt, n, i int) *Config {
+	log.Debug().Msgf("Retrying in %s (%d/%d)", config.ResponseLanguage, attempt, responseLanguageRetries)
+	retryConfig := *config
+	if retryConfig.Seed != 0 {
+		// a fixed seed would give the same answer
+		retryConfig.Seed += attempt*n + i
+	}
+	return &retryConfig
+}
+
+// computeChoices generates the choices, replaced in the tests
+var computeChoices = ComputeChoices
+
+// computeInLanguage computes the choices as ComputeChoices does, then
+// generates again the ones not written in the response language
+func computeInLanguage(predInput string, input *OpenAIRequest, config *Config, loader *model.ModelLoader, cb func(string, *[]Choice), choiceText func(Choice) string) ([]Choice, error) {
+	result, err := computeChoices(predInput, input, config, loader, cb, nil)
+	if err != nil || config.ResponseLanguage == "" {
+		return result, err
+	}
+
+	single := *input
+	single.N = 1
+	for i := range result {
+		for attempt := 1; attempt <= responseLanguageRetries && !inLanguage(choiceText(result[i]), config.ResponseLanguage); attempt++ {
+			r, err := computeChoices(predInput, &single, retryInLanguage(config, attempt, len(result), i), loader, cb, nil)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = r[0]
+		}
+	}
+	return result, nil
+}
+
+// languageGate holds the beginning of a streamed answer until its language
+// can be checked, and stops the generation if it's not the response language
+type languageGate struct {
+	language string
+	// last is true on the last attempt, which is sent whatever its language
+	last bool
+	send func(string) bool
+
+	buffer   string
+	open     bool
+	rejected bool
+}
+
+// token is the token callback of the generation
+func (g *languageGate) token(s string) bool {
+	if g.open {
+		return g.send(s)
+	}
+	g.buffer += s
+	if len(g.buffer) < responseLanguageSample {
+		return true
+	}
+	return g.check()
+}
+
+// check sends the buffered answer if it's in the response language, and
+// rejects it otherwise
+func (g *languageGate) check() bool {
+	if !g.last && !inLanguage(g.buffer, g.language) {
+		g.rejected = true
+		return false
+	}
+	g.open = true
+	if g.buffer == "" {
+		return true
+	}
+	return g.send(g.buffer)
+}
+
+// end checks the answers shorter than the sample, once generated. It returns
+// false if the answer was rejected
+func (g *languageGate) end() bool {
+	if !g.open && !g.rejected {
+		g.check()
+	}
+	return !g.rejected
+}
+
+// streamInLanguage streams the choices as ComputeChoices does. With a
+// response language, the beginning of the answer is held back until its
+// language is checked, and the answer is generated again if it is not the
+// requested one
+func streamInLanguage(predInput string, input *OpenAIRequest, config *Config, loader *model.ModelLoader, cb func(string, *[]Choice), tokenCallback func(string) bool) ([]Choice, error) {
+	if config.ResponseLanguage == "" {
+		return computeChoices(predInput, input, config, loader, cb, tokenCallback)
+	}
+
+	n := input.N
+	if n == 0 {
+		n = 1
+	}
+	attemptConfig := config
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			attemptConfig = retryInLanguage(config, attempt, n, 0)
+		}
+		gate := &languageGate{language: config.ResponseLanguage, last: attempt == responseLanguageRetries, send: tokenCallback}
+		result, err := computeChoices(predInput, input, attemptConfig, loader, cb, gate.token)
+		if err != nil || gate.end() {
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"strings"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response language", func() {
+	italian := "Il gatto è sul tavolo e non si muove, perché dorme. " + strings.Repeat("Anche il cane dorme con il gatto. ", 3)
+	english := "The cat is on the table and it doesn't move, as it is sleeping. " + strings.Repeat("The dog is sleeping with the cat. ", 3)
+
+	var sent []string
+	gate := func(last bool) *languageGate {
+		sent = nil
+		return &languageGate{language: "Italian", last: last, send: func(s string) bool {
+			sent = append(sent, s)
+			return true
+		}}
+	}
+	// generate feeds the answer to the gate word by word, as a backend would
+	generate := func(g *languageGate, answer string) {
+		for _, w := range strings.SplitAfter(answer, " ") {
+			if !g.token(w) {
+				return
+			}
+		}
+	}
+
+	It("checks the answers in the languages it knows", func() {
+		Expect(inLanguage(italian, "Italian")).To(BeTrue())
+		Expect(inLanguage(english, "Italian")).To(BeFalse())
+		Expect(inLanguage(english, "english")).To(BeTrue())
+		// not recognized, not checked
+		Expect(inLanguage("Ok.", "Italian")).To(BeTrue())
+	})
+	It("compares the codes of the languages", func() {
+		Expect(sameLanguage("Portuguese", "pt-BR")).To(BeTrue())
+		Expect(sameLanguage("English", "english")).To(BeTrue())
+		Expect(sameLanguage("English", "Old English")).To(BeFalse())
+		Expect(sameLanguage("Chinese", "Chinese Traditional")).To(BeFalse())
+		Expect(sameLanguage("Klingon", "Klingon")).To(BeFalse())
+	})
+	It("streams the answers in the response language", func() {
+		g := gate(false)
+		generate(g, italian)
+		Expect(g.end()).To(BeTrue())
+		Expect(strings.Join(sent, "")).To(Equal(italian))
+		// the beginning was held back to be checked
+		Expect(len(sent[0])).To(BeNumerically(">=", responseLanguageSample))
+	})
+	It("stops the answers in another language before sending them", func() {
+		g := gate(false)
+		generate(g, english)
+		Expect(g.end()).To(BeFalse())
+		Expect(sent).To(BeEmpty())
+	})
+	It("checks the short answers once generated", func() {
+		g := gate(false)
+		generate(g, "The cat is on the table.")
+		Expect(sent).To(BeEmpty())
+		Expect(g.end()).To(BeFalse())
+
+		g = gate(false)
+		generate(g, "Il gatto è sul tavolo.")
+		Expect(g.end()).To(BeTrue())
+		Expect(sent).To(Equal([]string{"Il gatto è sul tavolo."}))
+	})
+	It("sends the last attempt anyway", func() {
+		g := gate(true)
+		generate(g, english)
+		Expect(g.end()).To(BeTrue())
+		Expect(strings.Join(sent, "")).To(Equal(english))
+	})
+
+	Context("generating", func() {
+		var answers []string
+		var seeds []int
+		BeforeEach(func() {
+			seeds = nil
+			// the backend answers in turn, token by token
+			computeChoices = func(predInput string, input *OpenAIRequest, config *Config, loader *model.ModelLoader, cb func(string, *[]Choice), tokenCallback func(string) bool) ([]Choice, error) {
+				result := []Choice{}
+				for i := 0; i < input.N || i == 0; i++ {
+					answer := answers[len(seeds)]
+					seeds = append(seeds, config.Seed+i)
+					if tokenCallback != nil {
+						for _, w := range strings.SplitAfter(answer, " ") {
+							if !tokenCallback(w) {
+								break
+							}
+						}
+					}
+					cb(answer, &result)
+				}
+				return result, nil
+			}
+			DeferCleanup(func() { computeChoices = ComputeChoices })
+		})
+		cb := func(s string, c *[]Choice) {
+			*c = append(*c, Choice{Text: s})
+		}
+		choiceText := func(c Choice) string { return c.Text }
+		italianConfig := func(seed int) *Config {
+			config := &Config{}
+			config.ResponseLanguage = "Italian"
+			config.Seed = seed
+			return config
+		}
+
+		It("generates again the answers in another language", func() {
+			answers = []string{english, english, italian}
+			result, err := computeInLanguage("", &OpenAIRequest{}, italianConfig(10), nil, cb, choiceText)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal([]Choice{{Text: italian}}))
+			// with a new seed each time
+			Expect(seeds).To(Equal([]int{10, 11, 12}))
+		})
+		It("doesn't reuse the seeds of the other choices", func() {
+			answers = []string{italian, english, english, italian}
+			result, err := computeInLanguage("", &OpenAIRequest{N: 2}, italianConfig(10), nil, cb, choiceText)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal([]Choice{{Text: italian}, {Text: italian}}))
+			Expect(seeds).To(Equal([]int{10, 11, 13, 15}))
+
+			seeds = nil
+			answers = []string{english, english, italian, italian}
+			_, err = streamInLanguage("", &OpenAIRequest{N: 2}, italianConfig(10), nil, cb, func(s string) bool { return true })
+			Expect(err).ToNot(HaveOccurred())
+			Expect(seeds).To(Equal([]int{10, 11, 12, 13}))
+		})
+		It("returns the last attempt in another language", func() {
+			answers = []string{english, english, english, italian}
+			result, err := computeInLanguage("", &OpenAIRequest{}, italianConfig(0), nil, cb, choiceText)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal([]Choice{{Text: english}}))
+			Expect(seeds).To(HaveLen(responseLanguageRetries + 1))
+		})
+		It("doesn't check the answers without a response language", func() {
+			answers = []string{english}
+			result, err := computeInLanguage("", &OpenAIRequest{}, &Config{}, nil, cb, choiceText)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result).To(Equal([]Choice{{Text: english}}))
+		})
+		It("streams the first answer in the response language", func() {
+			answers = []string{english, italian}
+			var streamed []string
+			_, err := streamInLanguage("", &OpenAIRequest{}, italianConfig(0), nil, cb, func(s string) bool {
+				streamed = append(streamed, s)
+				return true
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(seeds).To(HaveLen(2))
+			Expect(strings.Join(streamed, "")).To(Equal(italian))
+		})
+	})
+})
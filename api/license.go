@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// matches e.g. CC-BY-NC-4.0, CC-BY-NC-SA or "non-commercial"
+var nonCommercialLicense = regexp.MustCompile(`(?i)(^|[-_ ])nc($|[-_ ])|non[-_ ]?commercial`)
+
+// nonCommercial reports whether the license of the model forbids its
+// commercial use
+func (c Config) nonCommercial() bool {
+	return c.NonCommercial || nonCommercialLicense.MatchString(c.License)
+}
+
+// checkLicense refuses the non-commercial models not acknowledged in their
+// config, if the loader requires it
+func checkLicense(loader *model.ModelLoader, c Config) error {
+	if !loader.RequireLicenseAck || !c.nonCommercial() || c.LicenseAcknowledged {
+		return nil
+	}
+	name := c.Name
+	if name == "" {
+		name = c.Model
+	}
+	return fiber.NewError(fiber.StatusForbidden,
+		fmt.Sprintf("model %s has a non-commercial license (%s): set license_acknowledged in its config to serve it", name, c.License))
+}
+
+// fileLicense gives the config the license of the configs of its model file,
+// if it has none: requesting the model file, or another config of it, must
+// not bypass the license. The license is acknowledged by any of the configs.
+func (cm ConfigMerger) fileLicense(c *Config) {
+	if c.Model == "" {
+		return
+	}
+	for _, other := range cm.snapshot() {
+		if other.Model != c.Model || !other.nonCommercial() {
+			continue
+		}
+		if !c.nonCommercial() {
+			c.License, c.NonCommercial = other.License, other.NonCommercial
+		}
+		c.LicenseAcknowledged = c.LicenseAcknowledged || other.LicenseAcknowledged
+	}
+}
+
+// modelInfo returns the model of the models list, with the metadata of its
+// config if any
+func modelInfo(id string, cm ConfigMerger) OpenAIModel {
+	m := OpenAIModel{ID: id, Object: "model"}
+	c, exists := cm.get(id)
+	if exists {
+		m.Description = c.Description
+		m.URL = c.URL
+	} else {
+		c.Model = id
+	}
+	cm.fileLicense(&c)
+	m.License = c.License
+	m.NonCommercial = c.nonCommercial()
+	return m
+}
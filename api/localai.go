@@ -0,0 +1,57 @@
+package api
+
+import (
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// modelLoadErrors returns the recent failed model load attempts, with the
+// backend that was tried and the reason of the failure
+func modelLoadErrors(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(struct {
+			Errors []model.LoadEvent `json:"errors"`
+		}{
+			Errors: loader.LoadErrors(),
+		})
+	}
+}
+
+// memoryStats returns the memory usage of the system and the loaded models,
+// to monitor the memory pressure on small devices
+func memoryStats(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		stats, err := loader.ReadMemoryStats()
+		if err != nil {
+			return err
+		}
+		return c.JSON(stats)
+	}
+}
+
+// backendsStatus reports which backends can load models, and why the other
+// ones can't
+func backendsStatus(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(struct {
+			Backends []model.BackendStatus `json:"backends"`
+		}{
+			Backends: loader.BackendsStatus(),
+		})
+	}
+}
+
+// resetBackend uses again a backend that crashed, without waiting for the
+// retry interval
+func resetBackend(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if err := loader.ResetBackend(c.Params("name")); err != nil {
+			return fiber.NewError(fiber.StatusNotFound, err.Error())
+		}
+		return c.JSON(struct {
+			Backends []model.BackendStatus `json:"backends"`
+		}{
+			Backends: loader.BackendsStatus(),
+		})
+	}
+}
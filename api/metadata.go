@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/donomii/go-rwkv.cpp"
+	"github.com/gofiber/fiber/v2"
+	gpt4all "github.com/nomic/gpt4all/gpt4all-bindings/golang"
+)
+
+const metadataHeader = "X-LocalAI-Metadata"
+
+// GenerationMetadata describes how a generation was produced, so downstream
+// systems can trace the provenance of the returned content.
+type GenerationMetadata struct {
+	Model   string `json:"model"`
+	Backend string `json:"backend,omitempty"`
+	// Seed is the seed of the first choice, the next choices use the
+	// following seeds. It is not set for the backends ignoring the seed
+	Seed        int     `json:"seed,omitempty"`
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+	TopK        int     `json:"top_k"`
+	Maxtokens   int     `json:"max_tokens"`
+	Created     int64   `json:"created"`
+	// ContentHash is the sha256 of the generated text of all the choices, in order
+	ContentHash string `json:"content_hash"`
+}
+
+// pinSeed makes sure a seed is set when metadata is requested, otherwise the
+// backend picks a random one and the generation can't be traced back.
+func pinSeed(config *Config) {
+	if config.Metadata && config.Seed == 0 {
+		config.Seed = rand.New(rand.NewSource(time.Now().UnixNano())).Intn(1 << 30)
+	}
+}
+
+// ignoresSeed returns true for the backends generating without a seed
+func ignoresSeed(inferenceModel interface{}) bool {
+	switch inferenceModel.(type) {
+	case *rwkv.RwkvState, *gpt4all.Model:
+		return true
+	}
+	return false
+}
+
+// choiceText returns the generated text of a choice, whatever the endpoint
+func choiceText(c Choice) string {
+	switch {
+	case c.Message != nil:
+		return c.Message.Content
+	case c.Delta != nil:
+		return c.Delta.Content
+	default:
+		return c.Text
+	}
+}
+
+func generationMetadata(config *Config, choices []Choice) *GenerationMetadata {
+	if !config.Metadata {
+		return nil
+	}
+
+	h := sha256.New()
+	for _, c := range choices {
+		h.Write([]byte(choiceText(c)))
+	}
+
+	seed := config.Seed
+	if config.seedIgnored != nil && config.seedIgnored.Load() {
+		seed = 0
+	}
+
+	return &GenerationMetadata{
+		Model:       config.Model,
+		Backend:     config.Backend,
+		Seed:        seed,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        config.TopK,
+		Maxtokens:   config.Maxtokens,
+		Created:     time.Now().Unix(),
+		ContentHash: "sha256:" + hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+func setMetadataHeader(c *fiber.Ctx, m *GenerationMetadata) {
+	if m == nil {
+		return
+	}
+	dat, err := json.Marshal(m)
+	if err != nil {
+		return
+	}
+	c.Set(metadataHeader, string(dat))
+}
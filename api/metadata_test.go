@@ -0,0 +1,53 @@
+package api
+
+import (
+	"sync/atomic"
+
+	"github.com/donomii/go-rwkv.cpp"
+	llama "github.com/go-skynet/go-llama.cpp"
+	gpt4all "github.com/nomic/gpt4all/gpt4all-bindings/golang"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generation metadata", func() {
+	It("pins the seed only when the metadata is requested", func() {
+		requested, notRequested := &Config{}, &Config{}
+		requested.Metadata = true
+		pinSeed(requested)
+		pinSeed(notRequested)
+		Expect(requested.Seed).ToNot(BeZero())
+		Expect(notRequested.Seed).To(BeZero())
+	})
+	It("keeps the seed of the request", func() {
+		config := &Config{}
+		config.Seed = 42
+		pinSeed(config)
+		Expect(config.Seed).To(Equal(42))
+	})
+	It("hashes the text of the choices", func() {
+		config := &Config{}
+		Expect(generationMetadata(config, []Choice{{Text: "hello"}})).To(BeNil())
+
+		config.Metadata = true
+		config.Model = "testmodel"
+		config.Seed = 42
+		metadata := generationMetadata(config, []Choice{{Text: "hel"}, {Message: &Message{Content: "lo"}}})
+		Expect(metadata.Model).To(Equal("testmodel"))
+		Expect(metadata.Seed).To(Equal(42))
+		// sha256 of "hello"
+		Expect(metadata.ContentHash).To(Equal("sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+	})
+	It("reports no seed for the backends ignoring it", func() {
+		config := &Config{seedIgnored: new(atomic.Bool)}
+		config.Metadata = true
+		config.Seed = 42
+		Expect(generationMetadata(config, nil).Seed).To(Equal(42))
+
+		Expect(ignoresSeed(&gpt4all.Model{})).To(BeTrue())
+		Expect(ignoresSeed(&rwkv.RwkvState{})).To(BeTrue())
+		Expect(ignoresSeed(&llama.LLama{})).To(BeFalse())
+		config.seedIgnored.Store(true)
+		Expect(generationMetadata(config, nil).Seed).To(BeZero())
+	})
+})
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// metrics writes metrics in the Prometheus text format
+type metrics struct {
+	strings.Builder
+}
+
+// labelEscaper escapes the label values as the text format requires: the
+// backslash, the double quote and the line feed only
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// helpEscaper escapes the help texts, where the quotes are left as they are
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// family starts a metric family, typ being e.g. "gauge" or "summary"
+func (m *metrics) family(name, typ, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, typ)
+}
+
+// sample writes a sample, labels being the names and the values of the
+// labels in turn
+func (m *metrics) sample(name string, value float64, labels ...string) {
+	m.WriteString(name)
+	if len(labels) > 0 {
+		m.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.WriteByte(',')
+			}
+			fmt.Fprintf(m, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		m.WriteByte('}')
+	}
+	fmt.Fprintf(m, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// loadMetrics writes the metrics of the model loads
+func loadMetrics(m *metrics, loader *model.ModelLoader) {
+	stats := loader.LoadStats()
+
+	m.family("localai_model_load_duration_seconds", "summary", "Duration of the model load attempts, by outcome")
+	for _, s := range stats {
+		status := "failure"
+		if s.Success {
+			status = "success"
+		}
+		labels := []string{"model", s.Model, "backend", s.Backend, "status", status}
+		m.sample("localai_model_load_duration_seconds_sum", s.Duration.Seconds(), labels...)
+		m.sample("localai_model_load_duration_seconds_count", float64(s.Count), labels...)
+	}
+
+	m.family("localai_model_load_memory_delta_bytes", "gauge", "Change of the resident memory across the last successful load of the model")
+	for _, s := range stats {
+		if s.Success {
+			m.sample("localai_model_load_memory_delta_bytes", float64(s.MemoryDelta), "model", s.Model, "backend", s.Backend, "load_mode", s.LoadMode)
+		}
+	}
+
+	m.family("localai_models_loaded", "gauge", "Number of models in memory")
+	m.sample("localai_models_loaded", float64(len(loader.LoadedModels())))
+}
+
+// memoryMetrics writes the memory of the system, to monitor the memory
+// pressure on small devices. Nothing is written where it can't be read.
+func memoryMetrics(m *metrics, loader *model.ModelLoader) {
+	stats, err := loader.ReadMemoryStats()
+	if err != nil {
+		return
+	}
+
+	m.family("localai_memory_total_bytes", "gauge", "Memory of the system")
+	m.sample("localai_memory_total_bytes", float64(stats.Total))
+	m.family("localai_memory_available_bytes", "gauge", "Memory available for starting new applications, without swapping")
+	m.sample("localai_memory_available_bytes", float64(stats.Available))
+	m.family("localai_swap_total_bytes", "gauge", "Swap space of the system")
+	m.sample("localai_swap_total_bytes", float64(stats.SwapTotal))
+	m.family("localai_swap_free_bytes", "gauge", "Unused swap space")
+	m.sample("localai_swap_free_bytes", float64(stats.SwapFree))
+	m.family("localai_resident_memory_bytes", "gauge", "Resident memory of LocalAI, the models included")
+	m.sample("localai_resident_memory_bytes", float64(stats.Resident))
+	m.family("localai_memory_pressure_percent", "gauge", "Share of time (0-100) some tasks were stalled waiting for memory, on kernels reporting it")
+	m.sample("localai_memory_pressure_percent", stats.Pressure10, "window", "10s")
+	m.sample("localai_memory_pressure_percent", stats.Pressure60, "window", "60s")
+}
+
+// metricsEndpoint exposes the metrics of the model loads, of the memory and
+// of the integrity checks in the Prometheus text format
+func metricsEndpoint(loader *model.ModelLoader, ic *integrityChecker) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		m := &metrics{}
+		loadMetrics(m, loader)
+		memoryMetrics(m, loader)
+		integrityMetrics(m, ic)
+
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4")
+		return c.SendString(m.String())
+	}
+}
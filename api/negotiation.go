@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	mimeNDJSON = "application/x-ndjson"
+	mimeJSONL  = "application/jsonl"
+)
+
+// respond sends the response in the format asked by the Accept header: the
+// OpenAI JSON by default, the generated text alone with text/plain, or a
+// JSON line per choice (or embedding) with application/x-ndjson or
+// application/jsonl
+func respond(c *fiber.Ctx, resp *OpenAIResponse) error {
+	offers := []string{fiber.MIMEApplicationJSON, mimeNDJSON, mimeJSONL}
+	if resp.Data == nil {
+		offers = append(offers, fiber.MIMETextPlain)
+	}
+
+	switch accepted := c.Accepts(offers...); accepted {
+	case fiber.MIMETextPlain:
+		texts := []string{}
+		for _, choice := range resp.Choices {
+			texts = append(texts, choiceText(choice))
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+		return c.SendString(strings.Join(texts, "\n"))
+	case mimeNDJSON, mimeJSONL:
+		lines := []interface{}{}
+		for i, choice := range resp.Choices {
+			// the index of the choices is omitted when 0 otherwise
+			lines = append(lines, struct {
+				Index int `json:"index"`
+				Choice
+			}{Index: i, Choice: choice})
+		}
+		for _, item := range resp.Data {
+			lines = append(lines, item)
+		}
+		return sendJSONLines(c, accepted, lines)
+	}
+	return c.JSON(resp)
+}
+
+func sendJSONLines(c *fiber.Ctx, contentType string, lines []interface{}) error {
+	var b strings.Builder
+	for _, l := range lines {
+		line, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.SendString(b.String())
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,12 +9,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
 	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/go-skynet/LocalAI/pkg/vector"
 	whisperutil "github.com/go-skynet/LocalAI/pkg/whisper"
-	llama "github.com/go-skynet/go-llama.cpp"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
 	"github.com/valyala/fasthttp"
@@ -54,6 +54,12 @@ type OpenAIResponse struct {
 	Data    []Item   `json:"data,omitempty"`
 
 	Usage OpenAIUsage `json:"usage"`
+
+	// Extension field, returned only if requested with return_metadata
+	Metadata *GenerationMetadata `json:"generation_metadata,omitempty"`
+	// Extension field, in the last event of a stream as the headers are
+	// sent before the generation
+	Accounting *Accounting `json:"accounting,omitempty"`
 }
 
 type Choice struct {
@@ -72,6 +78,12 @@ type Message struct {
 type OpenAIModel struct {
 	ID     string `json:"id"`
 	Object string `json:"object"`
+
+	// Extension fields, from the model config
+	Description   string `json:"description,omitempty"`
+	License       string `json:"license,omitempty"`
+	URL           string `json:"url,omitempty"`
+	NonCommercial bool   `json:"non_commercial,omitempty"`
 }
 
 type OpenAIRequest struct {
@@ -93,14 +105,26 @@ type OpenAIRequest struct {
 
 	// Messages is read only by chat/completion API calls
 	Messages []Message `json:"messages" yaml:"messages"`
+	// SessionID keeps the conversation server-side across chat/completion calls
+	SessionID string `json:"session_id"`
 
-	Stream bool `json:"stream"`
-	Echo   bool `json:"echo"`
+	// PromptRef is the name of a prompt of the prompt library, rendered
+	// with PromptVariables
+	PromptRef       string                 `json:"prompt_ref"`
+	PromptVariables map[string]interface{} `json:"prompt_variables"`
+
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options" yaml:"stream_options"`
+	Echo          bool           `json:"echo"`
 	// Common options between all the API calls
 	TopP        float64 `json:"top_p" yaml:"top_p"`
 	TopK        int     `json:"top_k" yaml:"top_k"`
 	Temperature float64 `json:"temperature" yaml:"temperature"`
 	Maxtokens   int     `json:"max_tokens" yaml:"max_tokens"`
+	// MaxTime stops the generation after the given seconds
+	MaxTime float64 `json:"max_time" yaml:"max_time"`
+	// ResponseLanguage is the language the answers must be written in
+	ResponseLanguage string `json:"response_language" yaml:"response_language"`
 
 	N int `json:"n"`
 
@@ -116,6 +140,17 @@ type OpenAIRequest struct {
 	Mirostat    int     `json:"mirostat" yaml:"mirostat"`
 
 	Seed int `json:"seed" yaml:"seed"`
+
+	// Embeddings
+	Dimensions int  `json:"dimensions" yaml:"dimensions"`
+	Normalize  bool `json:"normalize" yaml:"normalize"`
+
+	// ReturnMetadata attaches the generation metadata to the response
+	Metadata bool `json:"return_metadata" yaml:"return_metadata"`
+
+	// Resumable keeps generating if the client disconnects from a stream,
+	// which can then be resumed with the stream ID
+	Resumable bool `json:"resumable" yaml:"resumable"`
 }
 
 func defaultRequest(modelFile string) OpenAIRequest {
@@ -146,6 +181,8 @@ func completionEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 
 		var result []Choice
 		for _, i := range config.PromptStrings {
+			i = withResponseLanguage(i, config, loader)
+
 			// A model can have a "file.bin.tmpl" file associated with a prompt template prefix
 			templatedInput, err := loader.TemplatePrefix(templateFile, struct {
 				Input string
@@ -155,9 +192,9 @@ func completionEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 				log.Debug().Msgf("Template found, input modified to: %s", i)
 			}
 
-			r, err := ComputeChoices(i, input, config, loader, func(s string, c *[]Choice) {
+			r, err := computeInLanguage(i, input, config, loader, func(s string, c *[]Choice) {
 				*c = append(*c, Choice{Text: s})
-			}, nil)
+			}, choiceText)
 			if err != nil {
 				return err
 			}
@@ -166,19 +203,39 @@ func completionEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 		}
 
 		resp := &OpenAIResponse{
-			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
-			Choices: result,
-			Object:  "text_completion",
+			Model:    input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Choices:  result,
+			Object:   "text_completion",
+			Metadata: generationMetadata(config, result),
 		}
+		setMetadataHeader(c, resp.Metadata)
 
 		jsonResult, _ := json.Marshal(resp)
 		log.Debug().Msgf("Response: %s", jsonResult)
 
 		// Return the prediction in the response body
-		return c.JSON(resp)
+		return respond(c, resp)
 	}
 }
 
+// reduceEmbeddings truncates the embeddings to the requested dimensions and
+// normalizes them if required. Truncation follows the Matryoshka
+// representation, where the first dimensions carry most of the information, so
+// truncated embeddings are always normalized as OpenAI does.
+func reduceEmbeddings(config *Config, embeddings []float32) ([]float32, error) {
+	if config.Dimensions > 0 {
+		if config.Dimensions > len(embeddings) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("dimensions (%d) exceeds the embeddings size of the model (%d)", config.Dimensions, len(embeddings)))
+		}
+		return vector.Normalize(embeddings[:config.Dimensions]), nil
+	}
+
+	if config.Normalize {
+		return vector.Normalize(embeddings), nil
+	}
+	return embeddings, nil
+}
+
 // https://platform.openai.com/docs/api-reference/embeddings
 func embeddingsEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, threads, ctx int, f16 bool) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
@@ -187,6 +244,8 @@ func embeddingsEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
 
+		defer useModel(loader, config)()
+
 		log.Debug().Msgf("Parameter Config: %+v", config)
 		items := []Item{}
 
@@ -201,6 +260,10 @@ func embeddingsEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 			if err != nil {
 				return err
 			}
+			embeddings, err = reduceEmbeddings(config, embeddings)
+			if err != nil {
+				return err
+			}
 			items = append(items, Item{Embedding: embeddings, Index: i, Object: "embedding"})
 		}
 
@@ -215,6 +278,10 @@ func embeddingsEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 			if err != nil {
 				return err
 			}
+			embeddings, err = reduceEmbeddings(config, embeddings)
+			if err != nil {
+				return err
+			}
 			items = append(items, Item{Embedding: embeddings, Index: i, Object: "embedding"})
 		}
 
@@ -228,14 +295,16 @@ func embeddingsEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 		log.Debug().Msgf("Response: %s", jsonResult)
 
 		// Return the prediction in the response body
-		return c.JSON(resp)
+		return respond(c, resp)
 	}
 }
 
 func chatEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, threads, ctx int, f16 bool) func(c *fiber.Ctx) error {
 
 	process := func(s string, req *OpenAIRequest, config *Config, loader *model.ModelLoader, responses chan OpenAIResponse) {
-		ComputeChoices(s, req, config, loader, func(s string, c *[]Choice) {}, func(s string) bool {
+		choices, err := streamInLanguage(s, req, config, loader, func(s string, c *[]Choice) {
+			*c = append(*c, Choice{})
+		}, func(s string) bool {
 			resp := OpenAIResponse{
 				Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
 				Choices: []Choice{{Delta: &Message{Role: "assistant", Content: s}}},
@@ -246,6 +315,12 @@ func chatEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, thread
 			responses <- resp
 			return true
 		})
+		if err != nil {
+			log.Error().Msgf("Stream failed: %s", err.Error())
+			responses <- OpenAIResponse{Choices: []Choice{{FinishReason: "error"}}}
+		} else if len(choices) > 0 && choices[0].FinishReason != "" {
+			responses <- OpenAIResponse{Choices: []Choice{{FinishReason: choices[0].FinishReason}}}
+		}
 		close(responses)
 	}
 	return func(c *fiber.Ctx) error {
@@ -258,8 +333,45 @@ func chatEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, thread
 
 		var predInput string
 
+		var session *Session
+		if input.SessionID != "" {
+			// without API keys the owners are not verified: the sessions are
+			// only created by the server, with IDs that can't be guessed
+			session, err = sessions.get(input.SessionID, requestOwner(c), requestAPIKey(c) != nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The prompt of the library is the system message, added once to
+		// the sessions
+		requestMessages := input.Messages
+		if config.systemPrompt != "" {
+			system := Message{Role: "system", Content: config.systemPrompt}
+			if session == nil || !session.has(system) {
+				requestMessages = append([]Message{system}, requestMessages...)
+			}
+		}
+
+		// Previous messages of the session, if any, come first
+		messages := requestMessages
+		if session != nil {
+			messages = append(session.history(), requestMessages...)
+		}
+		// the failed generations are not recorded, the client can retry them
+		recordSession := func(reply, finishReason string) {
+			if session != nil && finishReason != "error" {
+				session.record(config, requestMessages, reply)
+			}
+		}
+
+		// not recorded in the session, the response language can change
+		if instruction := responseLanguageInstruction(config, loader); instruction != "" {
+			messages = append([]Message{{Role: "system", Content: instruction}}, messages...)
+		}
+
 		mess := []string{}
-		for _, i := range input.Messages {
+		for _, i := range messages {
 			r := config.Roles[i.Role]
 			if r == "" {
 				r = i.Role
@@ -301,49 +413,53 @@ func chatEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, thread
 
 			go process(predInput, input, config, loader, responses)
 
-			c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			if config.Resumable {
+				stream := streams.create(requestOwner(c))
+				go func() {
+					recordSession(streamChat(input, config, responses, func(ev OpenAIResponse) {
+						ev.ID = stream.id
+						stream.append(ev)
+					}))
+					streams.complete(stream)
+				}()
+
+				c.Set(streamIDHeader, stream.id)
+				c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+					stream.writeTo(w, 0)
+				}))
+				return nil
+			}
 
-				for ev := range responses {
-					var buf bytes.Buffer
-					enc := json.NewEncoder(&buf)
-					enc.Encode(ev)
-
-					fmt.Fprintf(w, "event: data\n\n")
-					fmt.Fprintf(w, "data: %v\n\n", buf.String())
-					log.Debug().Msgf("Sending chunk: %s", buf.String())
-					w.Flush()
-				}
-
-				w.WriteString("event: data\n\n")
-				resp := &OpenAIResponse{
-					Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
-					Choices: []Choice{{FinishReason: "stop"}},
-				}
-				respData, _ := json.Marshal(resp)
-
-				w.WriteString(fmt.Sprintf("data: %s\n\n", respData))
-				w.Flush()
+			c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+				recordSession(streamChat(input, config, responses, func(ev OpenAIResponse) {
+					writeEvent(w, ev)
+				}))
 			}))
 			return nil
 		}
 
-		result, err := ComputeChoices(predInput, input, config, loader, func(s string, c *[]Choice) {
+		result, err := computeInLanguage(predInput, input, config, loader, func(s string, c *[]Choice) {
 			*c = append(*c, Choice{Message: &Message{Role: "assistant", Content: s}})
-		}, nil)
+		}, choiceText)
 		if err != nil {
 			return err
 		}
+		if len(result) > 0 {
+			recordSession(result[0].Message.Content, result[0].FinishReason)
+		}
 
 		resp := &OpenAIResponse{
-			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
-			Choices: result,
-			Object:  "chat.completion",
+			Model:    input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Choices:  result,
+			Object:   "chat.completion",
+			Metadata: generationMetadata(config, result),
 		}
+		setMetadataHeader(c, resp.Metadata)
 		respData, _ := json.Marshal(resp)
 		log.Debug().Msgf("Response: %s", respData)
 
 		// Return the prediction in the response body
-		return c.JSON(resp)
+		return respond(c, resp)
 	}
 }
 
@@ -364,6 +480,8 @@ func editEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, thread
 
 		var result []Choice
 		for _, i := range config.InputStrings {
+			i = withResponseLanguage(i, config, loader)
+
 			// A model can have a "file.bin.tmpl" file associated with a prompt template prefix
 			templatedInput, err := loader.TemplatePrefix(templateFile, struct {
 				Input       string
@@ -374,9 +492,9 @@ func editEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, thread
 				log.Debug().Msgf("Template found, input modified to: %s", i)
 			}
 
-			r, err := ComputeChoices(i, input, config, loader, func(s string, c *[]Choice) {
+			r, err := computeInLanguage(i, input, config, loader, func(s string, c *[]Choice) {
 				*c = append(*c, Choice{Text: s})
-			}, nil)
+			}, choiceText)
 			if err != nil {
 				return err
 			}
@@ -385,16 +503,18 @@ func editEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, thread
 		}
 
 		resp := &OpenAIResponse{
-			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
-			Choices: result,
-			Object:  "edit",
+			Model:    input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Choices:  result,
+			Object:   "edit",
+			Metadata: generationMetadata(config, result),
 		}
+		setMetadataHeader(c, resp.Metadata)
 
 		jsonResult, _ := json.Marshal(resp)
 		log.Debug().Msgf("Response: %s", jsonResult)
 
 		// Return the prediction in the response body
-		return c.JSON(resp)
+		return respond(c, resp)
 	}
 }
 
@@ -437,7 +557,10 @@ func transcriptEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 
 		log.Debug().Msgf("Audio file copied to: %+v", dst)
 
-		whisperModel, err := loader.BackendLoader(model.WhisperBackend, config.Model, []llama.ModelOption{}, uint32(config.Threads))
+		defer useModel(loader, config)()
+
+		config.Backend = model.WhisperBackend
+		whisperModel, err := loadModel(loader, *config)
 		if err != nil {
 			return err
 		}
@@ -464,21 +587,34 @@ func transcriptEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader,
 
 func listModels(loader *model.ModelLoader, cm ConfigMerger) func(ctx *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		models, err := loader.ListModels()
+		models, err := loader.CachedListModels()
 		if err != nil {
 			return err
 		}
 		var mm map[string]interface{} = map[string]interface{}{}
 
+		// only list the models the api key can use
+		key := requestAPIKey(c)
+		allowed := func(m string) bool { return key == nil || key.allows(m) }
+
 		dataModels := []OpenAIModel{}
 		for _, m := range models {
 			mm[m] = nil
-			dataModels = append(dataModels, OpenAIModel{ID: m, Object: "model"})
+			if allowed(m) {
+				dataModels = append(dataModels, modelInfo(m, cm))
+			}
 		}
 
-		for k := range cm {
-			if _, exists := mm[k]; !exists {
-				dataModels = append(dataModels, OpenAIModel{ID: k, Object: "model"})
+		// sorted, for the list to have a stable ETag
+		names := []string{}
+		for k := range cm.snapshot() {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		for _, k := range names {
+			if _, exists := mm[k]; !exists && allowed(k) {
+				dataModels = append(dataModels, modelInfo(k, cm))
 			}
 		}
 
@@ -491,3 +627,28 @@ func listModels(loader *model.ModelLoader, cm ConfigMerger) func(ctx *fiber.Ctx)
 		})
 	}
 }
+
+// https://platform.openai.com/docs/api-reference/models/retrieve
+func retrieveModel(loader *model.ModelLoader, cm ConfigMerger) func(ctx *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("model")
+		if key := requestAPIKey(c); key != nil && !key.allows(id) {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("model %s not found", id))
+		}
+
+		_, exists := cm.get(id)
+		if !exists {
+			models, err := loader.CachedListModels()
+			if err != nil {
+				return err
+			}
+			for _, m := range models {
+				exists = exists || m == id
+			}
+		}
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("model %s not found", id))
+		}
+		return c.JSON(modelInfo(id, cm))
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/donomii/go-rwkv.cpp"
 	model "github.com/go-skynet/LocalAI/pkg/model"
@@ -13,12 +14,109 @@ import (
 	gpt2 "github.com/go-skynet/go-gpt2.cpp"
 	llama "github.com/go-skynet/go-llama.cpp"
 	gpt4all "github.com/nomic/gpt4all/gpt4all-bindings/golang"
+	"github.com/rs/zerolog/log"
 )
 
 // mutex still needed, see: https://github.com/ggerganov/llama.cpp/discussions/784
 var mutexMap sync.Mutex
 var mutexes map[string]*sync.Mutex = make(map[string]*sync.Mutex)
 
+// modelMutex returns the mutex serializing the calls to a model
+func modelMutex(modelFile string) *sync.Mutex {
+	mutexMap.Lock()
+	defer mutexMap.Unlock()
+	l, ok := mutexes[modelFile]
+	if !ok {
+		l = &sync.Mutex{}
+		mutexes[modelFile] = l
+	}
+	return l
+}
+
+// lowMemoryMu serializes the requests in low memory mode, from the load of
+// the model to the end of the inference, so that a model is never unloaded
+// while in use
+var lowMemoryMu sync.Mutex
+
+// lowMemoryBatch is the largest batch of tokens evaluated at once in low
+// memory mode: the buffers of the evaluation grow with it
+const lowMemoryBatch = 8
+
+// lowMemoryLock locks lowMemoryMu in low memory mode, and returns the function
+// unlocking it
+func lowMemoryLock(loader *model.ModelLoader) func() {
+	if !loader.LowMemory {
+		return func() {}
+	}
+	lowMemoryMu.Lock()
+	return lowMemoryMu.Unlock
+}
+
+// useModel marks the model of the config as used by the request until the
+// returned function is called, from its load to the end of the inference, so
+// that the model is not freed meanwhile. It locks lowMemoryMu as well.
+func useModel(loader *model.ModelLoader, c *Config) func() {
+	unlock := lowMemoryLock(loader)
+	release := loader.Use(c.Model)
+	return func() {
+		release()
+		unlock()
+	}
+}
+
+// loadModel loads the model of the config with its backend, or guessing the
+// backend if not specified. In low memory mode, the other models are unloaded
+// first, and lowMemoryMu must be held.
+func loadModel(loader *model.ModelLoader, c Config) (interface{}, error) {
+	if err := checkLicense(loader, c); err != nil {
+		return nil, err
+	}
+
+	llamaOpts := defaultLLamaOpts(c)
+
+	if loader.LowMemory {
+		for _, m := range loader.LoadedModels() {
+			if m != c.Model {
+				if err := loader.UnloadModel(m); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := checkBackendOptions(c.Backend, c.BackendOptions); err != nil {
+		return nil, err
+	}
+
+	var m interface{}
+	load := func() (err error) {
+		if c.Backend == "" {
+			m, err = loader.GreedyLoader(c.Model, llamaOpts, uint32(c.Threads))
+		} else {
+			m, err = loader.BackendLoader(c.Backend, c.Model, llamaOpts, uint32(c.Threads))
+		}
+		return err
+	}
+	// the environment is only needed by the loads
+	env := c.Environment
+	if loader.Loaded(c.Model) {
+		env = nil
+	}
+	if err := withEnvironment(env, load); err != nil {
+		return nil, err
+	}
+
+	// the guessed backend might not support all the options
+	if c.Backend == "" && len(c.BackendOptions) > 0 {
+		backend := modelBackend(m)
+		if backend == "" {
+			return nil, fmt.Errorf("the backend of the model doesn't support backend options")
+		}
+		return m, checkBackendOptions(backend, c.BackendOptions)
+	}
+	return m, nil
+}
+
 func defaultLLamaOpts(c Config) []llama.ModelOption {
 	llamaOpts := []llama.ModelOption{}
 	if c.ContextSize != 0 {
@@ -31,6 +129,10 @@ func defaultLLamaOpts(c Config) []llama.ModelOption {
 		llamaOpts = append(llamaOpts, llama.EnableEmbeddings)
 	}
 
+	if len(c.BackendOptions) > 0 {
+		llamaOpts = append(llamaOpts, llamaModelOptions(c))
+	}
+
 	return llamaOpts
 }
 
@@ -41,15 +143,7 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, c Config)
 
 	modelFile := c.Model
 
-	llamaOpts := defaultLLamaOpts(c)
-
-	var inferenceModel interface{}
-	var err error
-	if c.Backend == "" {
-		inferenceModel, err = loader.GreedyLoader(modelFile, llamaOpts, uint32(c.Threads))
-	} else {
-		inferenceModel, err = loader.BackendLoader(c.Backend, modelFile, llamaOpts, uint32(c.Threads))
-	}
+	inferenceModel, err := loadModel(loader, c)
 	if err != nil {
 		return nil, err
 	}
@@ -60,16 +154,20 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, c Config)
 		fn = func() ([]float32, error) {
 			predictOptions := buildLLamaPredictOptions(c)
 			if len(tokens) > 0 {
+				c.stats.promptTokensCounted(len(tokens))
 				return model.TokenEmbeddings(tokens, predictOptions...)
 			}
+			c.stats.promptTokensCounted(-1)
 			return model.Embeddings(s, predictOptions...)
 		}
 	// bert embeddings
 	case *bert.Bert:
 		fn = func() ([]float32, error) {
 			if len(tokens) > 0 {
+				c.stats.promptTokensCounted(len(tokens))
 				return model.TokenEmbeddings(tokens, bert.SetThreads(c.Threads))
 			}
+			c.stats.promptTokensCounted(-1)
 			return model.Embeddings(s, bert.SetThreads(c.Threads))
 		}
 	default:
@@ -80,18 +178,18 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, c Config)
 
 	return func() ([]float32, error) {
 		// This is still needed, see: https://github.com/ggerganov/llama.cpp/discussions/784
-		mutexMap.Lock()
-		l, ok := mutexes[modelFile]
-		if !ok {
-			m := &sync.Mutex{}
-			mutexes[modelFile] = m
-			l = m
-		}
-		mutexMap.Unlock()
-		l.Lock()
+		l := modelMutex(modelFile)
+		c.stats.lock(l)
 		defer l.Unlock()
 
-		embeds, err := fn()
+		// not while another model loads with its environment
+		environmentMu.RLock()
+		defer environmentMu.RUnlock()
+
+		var embeds []float32
+		var err error
+		c.stats.run(func() { embeds, err = fn() })
+		c.stats.processed(s, "")
 		if err != nil {
 			return embeds, err
 		}
@@ -159,6 +257,10 @@ func buildLLamaPredictOptions(c Config) []llama.PredictOption {
 		predictOptions = append(predictOptions, llama.SetSeed(c.Seed))
 	}
 
+	if len(c.BackendOptions) > 0 {
+		predictOptions = append(predictOptions, llamaPredictOptions(c))
+	}
+
 	return predictOptions
 }
 
@@ -166,15 +268,7 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 	supportStreams := false
 	modelFile := c.Model
 
-	llamaOpts := defaultLLamaOpts(c)
-
-	var inferenceModel interface{}
-	var err error
-	if c.Backend == "" {
-		inferenceModel, err = loader.GreedyLoader(modelFile, llamaOpts, uint32(c.Threads))
-	} else {
-		inferenceModel, err = loader.BackendLoader(c.Backend, modelFile, llamaOpts, uint32(c.Threads))
-	}
+	inferenceModel, err := loadModel(loader, c)
 	if err != nil {
 		return nil, err
 	}
@@ -191,6 +285,12 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				stopWord = c.StopWords[0]
 			}
 
+			// the only binding exposing its tokenizer
+			if tokens, err := model.Tokenizer.Encode(s); err == nil {
+				c.stats.promptTokensCounted(len(tokens))
+			} else {
+				c.stats.promptTokensCounted(-1)
+			}
 			if err := model.ProcessInput(s); err != nil {
 				return "", err
 			}
@@ -214,6 +314,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -238,6 +342,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -262,6 +370,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -286,6 +398,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -330,6 +446,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -354,6 +474,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -378,6 +502,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt2.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt2PredictOptions(c))
+			}
+
 			if c.Seed != 0 {
 				predictOptions = append(predictOptions, gpt2.SetSeed(c.Seed))
 			}
@@ -407,6 +535,10 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 				predictOptions = append(predictOptions, gpt4all.SetBatch(c.Batch))
 			}
 
+			if len(c.BackendOptions) > 0 {
+				predictOptions = append(predictOptions, gpt4allPredictOptions(c))
+			}
+
 			str, er := model.Predict(
 				s,
 				predictOptions...,
@@ -439,20 +571,32 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 		}
 	}
 
+	// count the tokens generated on the backends reporting them. The
+	// prediction functions above see the wrapped callback
+	if supportStreams {
+		tokenCallback = c.stats.countTokens(tokenCallback)
+	}
+	if _, rwkvModel := inferenceModel.(*rwkv.RwkvState); !rwkvModel {
+		c.stats.promptTokensCounted(-1)
+	}
+	if ignoresSeed(inferenceModel) && c.seedIgnored != nil {
+		c.seedIgnored.Store(true)
+	}
+
 	return func() (string, error) {
 		// This is still needed, see: https://github.com/ggerganov/llama.cpp/discussions/784
-		mutexMap.Lock()
-		l, ok := mutexes[modelFile]
-		if !ok {
-			m := &sync.Mutex{}
-			mutexes[modelFile] = m
-			l = m
-		}
-		mutexMap.Unlock()
-		l.Lock()
+		l := modelMutex(modelFile)
+		c.stats.lock(l)
 		defer l.Unlock()
 
-		res, err := fn()
+		// not while another model loads with its environment
+		environmentMu.RLock()
+		defer environmentMu.RUnlock()
+
+		var res string
+		var err error
+		c.stats.run(func() { res, err = fn() })
+		c.stats.processed(s, res)
 		if tokenCallback != nil && !supportStreams {
 			tokenCallback(res)
 		}
@@ -460,29 +604,115 @@ func ModelInference(s string, loader *model.ModelLoader, c Config, tokenCallback
 	}, nil
 }
 
+// generationTimer stops the generations running for longer than max_time.
+// Only the backends streaming their tokens can be stopped
+type generationTimer struct {
+	maxTime  time.Duration
+	deadline time.Time
+	timedOut bool
+	now      func() time.Time
+}
+
+func newGenerationTimer(maxTime float64) *generationTimer {
+	return &generationTimer{maxTime: time.Duration(maxTime * float64(time.Second)), now: time.Now}
+}
+
+// start is called before each generation
+func (t *generationTimer) start() {
+	t.deadline = t.now().Add(t.maxTime)
+	t.timedOut = false
+}
+
+// token wraps the token callback of the generations, to stop them once
+// the deadline passed
+func (t *generationTimer) token(cb func(string) bool) func(string) bool {
+	if t.maxTime == 0 {
+		return cb
+	}
+	return func(s string) bool {
+		if t.now().After(t.deadline) {
+			t.timedOut = true
+			return false
+		}
+		if cb == nil {
+			return true
+		}
+		return cb(s)
+	}
+}
+
 func ComputeChoices(predInput string, input *OpenAIRequest, config *Config, loader *model.ModelLoader, cb func(string, *[]Choice), tokenCallback func(string) bool) ([]Choice, error) {
 	result := []Choice{}
 
+	// held until all the choices are generated
+	defer useModel(loader, config)()
+
 	n := input.N
 
 	if input.N == 0 {
 		n = 1
 	}
 
-	// get the model function to call for the result
-	predFunc, err := ModelInference(predInput, loader, *config, tokenCallback)
-	if err != nil {
-		return result, err
+	// A generation can't be retried once tokens were streamed to the client
+	streamed := false
+	if tokenCallback != nil {
+		cb := tokenCallback
+		tokenCallback = func(s string) bool {
+			streamed = true
+			return cb(s)
+		}
 	}
+	notStreamed := func() bool { return !streamed }
+
+	timer := newGenerationTimer(config.MaxTime)
+	tokenCallback = timer.token(tokenCallback)
 
+	// Stop the generation once the client is gone, unless it can resume it
+	if ctx := config.ctx; ctx != nil && !config.Resumable {
+		cb := tokenCallback
+		tokenCallback = func(s string) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			if cb == nil {
+				return true
+			}
+			return cb(s)
+		}
+	}
+
+	var err error
 	for i := 0; i < n; i++ {
-		prediction, err := predFunc()
+		// the choices would be the same with the same seed
+		choiceConfig := *config
+		if choiceConfig.Seed != 0 {
+			choiceConfig.Seed += i
+		}
+
+		// get the model function to call for the result. The load errors are
+		// not retried, only the prediction ones
+		var predFunc func() (string, error)
+		predFunc, err = ModelInference(predInput, loader, choiceConfig, tokenCallback)
+		if err != nil {
+			return result, err
+		}
+
+		var prediction string
+		err = withRetry(config.Retry, func() (err error) {
+			timer.start()
+			prediction, err = predFunc()
+			return err
+		}, notStreamed)
 		if err != nil {
 			return result, err
 		}
 
 		prediction = Finetune(*config, predInput, prediction)
 		cb(prediction, &result)
+		if timer.timedOut && len(result) > 0 {
+			log.Debug().Msgf("Generation stopped after max_time (%gs)", config.MaxTime)
+			result[len(result)-1].FinishReason = "timeout"
+		}
 
 		//result = append(result, Choice{Text: prediction})
 
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generation timer", func() {
+	var now time.Time
+	var timer *generationTimer
+	var tokens []string
+	callback := func(s string) bool {
+		tokens = append(tokens, s)
+		return true
+	}
+	BeforeEach(func() {
+		now = time.Now()
+		tokens = nil
+		timer = newGenerationTimer(0.5)
+		timer.now = func() time.Time { return now }
+	})
+
+	It("stops the generations after max_time", func() {
+		cb := timer.token(callback)
+		timer.start()
+		Expect(cb("hello")).To(BeTrue())
+		now = now.Add(400 * time.Millisecond)
+		Expect(cb(" world")).To(BeTrue())
+		Expect(timer.timedOut).To(BeFalse())
+		now = now.Add(200 * time.Millisecond)
+		Expect(cb("!")).To(BeFalse())
+		Expect(timer.timedOut).To(BeTrue())
+		Expect(tokens).To(Equal([]string{"hello", " world"}))
+	})
+	It("restarts with every generation", func() {
+		cb := timer.token(nil)
+		timer.start()
+		now = now.Add(time.Second)
+		Expect(cb("hello")).To(BeFalse())
+		timer.start()
+		Expect(timer.timedOut).To(BeFalse())
+		Expect(cb("hello")).To(BeTrue())
+	})
+	It("doesn't stop the generations without max_time", func() {
+		timer = newGenerationTimer(0)
+		Expect(timer.token(nil)).To(BeNil())
+	})
+	It("ends the streams with the finish reason of the generation", func() {
+		responses := make(chan OpenAIResponse, 2)
+		responses <- OpenAIResponse{Choices: []Choice{{Delta: &Message{Content: "hello"}}}}
+		responses <- OpenAIResponse{Choices: []Choice{{FinishReason: "timeout"}}}
+		close(responses)
+
+		var last OpenAIResponse
+		generated, finishReason := streamChat(&OpenAIRequest{}, &Config{}, responses, func(ev OpenAIResponse) {
+			last = ev
+		})
+		Expect(generated).To(Equal("hello"))
+		Expect(finishReason).To(Equal("timeout"))
+		Expect(last.Choices[0].FinishReason).To(Equal("timeout"))
+	})
+})
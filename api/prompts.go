@@ -0,0 +1,195 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PromptsDir is the directory of the models path holding the prompt library
+const PromptsDir = "prompts"
+
+var validPromptName = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+
+// Prompt is a prompt template stored server-side, referenced by name by the
+// requests with prompt_ref
+type Prompt struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+}
+
+// promptLibrary stores the prompts as templates files in a directory, so they
+// can also be managed directly on disk
+type promptLibrary struct {
+	path string
+}
+
+// serializes the changes to the prompts files
+var promptsMu sync.Mutex
+
+func newPromptLibrary(loader *model.ModelLoader) *promptLibrary {
+	return &promptLibrary{path: filepath.Join(loader.ModelPath, PromptsDir)}
+}
+
+func (p *promptLibrary) file(name string) (string, error) {
+	if !validPromptName.MatchString(name) {
+		return "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid prompt name %q", name))
+	}
+	return filepath.Join(p.path, name+".tmpl"), nil
+}
+
+func (p *promptLibrary) get(name string) (*Prompt, error) {
+	file, err := p.file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	promptsMu.Lock()
+	defer promptsMu.Unlock()
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("prompt %s not found", name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Prompt{Name: name, Template: string(b)}, nil
+}
+
+func (p *promptLibrary) list() ([]Prompt, error) {
+	promptsMu.Lock()
+	defer promptsMu.Unlock()
+	files, err := os.ReadDir(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Prompt{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	prompts := []Prompt{}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".tmpl")
+		if f.IsDir() || name == f.Name() || !validPromptName.MatchString(name) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(p.path, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		prompts = append(prompts, Prompt{Name: name, Template: string(b)})
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts, nil
+}
+
+func (p *promptLibrary) save(prompt *Prompt) error {
+	file, err := p.file(prompt.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := template.New(prompt.Name).Parse(prompt.Template); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid template: %s", err.Error()))
+	}
+
+	promptsMu.Lock()
+	defer promptsMu.Unlock()
+	if err := os.MkdirAll(p.path, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(prompt.Template), 0644)
+}
+
+func (p *promptLibrary) delete(name string) error {
+	file, err := p.file(name)
+	if err != nil {
+		return err
+	}
+
+	promptsMu.Lock()
+	defer promptsMu.Unlock()
+	err = os.Remove(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("prompt %s not found", name))
+	}
+	return err
+}
+
+// render executes the prompt template with the variables of the request
+func (p *promptLibrary) render(name string, variables map[string]interface{}) (string, error) {
+	prompt, err := p.get(name)
+	if err != nil {
+		return "", err
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(prompt.Template)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, variables); err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("failed rendering prompt %s: %s", name, err.Error()))
+	}
+	return buf.String(), nil
+}
+
+func listPromptsEndpoint(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		prompts, err := newPromptLibrary(loader).list()
+		if err != nil {
+			return err
+		}
+		return c.JSON(struct {
+			Object string   `json:"object"`
+			Data   []Prompt `json:"data"`
+		}{
+			Object: "list",
+			Data:   prompts,
+		})
+	}
+}
+
+func getPromptEndpoint(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		prompt, err := newPromptLibrary(loader).get(c.Params("name"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(prompt)
+	}
+}
+
+// savePromptEndpoint creates or replaces a prompt
+func savePromptEndpoint(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		prompt := new(Prompt)
+		if err := c.BodyParser(prompt); err != nil {
+			return err
+		}
+		prompt.Name = c.Params("name")
+
+		if err := newPromptLibrary(loader).save(prompt); err != nil {
+			return err
+		}
+		return c.JSON(prompt)
+	}
+}
+
+func deletePromptEndpoint(loader *model.ModelLoader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if err := newPromptLibrary(loader).delete(c.Params("name")); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+const streamIDHeader = "X-LocalAI-Stream-ID"
+
+// how long a completed stream is kept in memory for the client to resume it
+const streamRetention = 10 * time.Minute
+
+// bufferedStream keeps all the events of a resumable stream, so a client
+// can reconnect and pick up from the last event it received.
+type bufferedStream struct {
+	id string
+	// owner is the credential of the client that started the stream, the
+	// only one allowed to resume it
+	owner  string
+	mu     sync.Mutex
+	events []OpenAIResponse
+	done   bool
+	// update is closed and replaced every time the stream changes
+	update chan struct{}
+}
+
+func (b *bufferedStream) append(ev OpenAIResponse) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events = append(b.events, ev)
+	close(b.update)
+	b.update = make(chan struct{})
+}
+
+func (b *bufferedStream) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = true
+	close(b.update)
+	b.update = make(chan struct{})
+}
+
+func (b *bufferedStream) from(offset int) ([]OpenAIResponse, bool, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if offset > len(b.events) {
+		offset = len(b.events)
+	} else if offset < 0 {
+		offset = 0
+	}
+	return b.events[offset:], b.done, b.update
+}
+
+// writeTo sends the events starting from offset, and keeps following the
+// stream until it is completed or the client goes away.
+func (b *bufferedStream) writeTo(w *bufio.Writer, offset int) {
+	for {
+		events, done, update := b.from(offset)
+		for _, ev := range events {
+			if err := writeEventWithID(w, strconv.Itoa(offset), ev); err != nil {
+				log.Debug().Msgf("Client disconnected from stream %s at event %d, buffering the rest", b.id, offset)
+				return
+			}
+			offset++
+		}
+		if done {
+			return
+		}
+		<-update
+	}
+}
+
+type streamStore struct {
+	mu      sync.Mutex
+	streams map[string]*bufferedStream
+}
+
+var streams = &streamStore{streams: make(map[string]*bufferedStream)}
+
+func (s *streamStore) create(owner string) *bufferedStream {
+	b := &bufferedStream{id: uuid.New().String(), owner: owner, update: make(chan struct{})}
+
+	s.mu.Lock()
+	s.streams[b.id] = b
+	s.mu.Unlock()
+
+	return b
+}
+
+// complete marks the stream as completed, and drops it once it has been
+// retained long enough
+func (s *streamStore) complete(b *bufferedStream) {
+	b.close()
+	time.AfterFunc(streamRetention, func() {
+		s.mu.Lock()
+		delete(s.streams, b.id)
+		s.mu.Unlock()
+	})
+}
+
+// get returns the stream, if it was started by owner
+func (s *streamStore) get(id, owner string) (*bufferedStream, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.streams[id]
+	if !ok || !sameOwner(b.owner, owner) {
+		return nil, false
+	}
+	return b, true
+}
+
+// resumeStreamEndpoint replays a resumable stream, starting from the "offset"
+// query parameter or from the event after the "Last-Event-ID" header.
+func resumeStreamEndpoint() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		// the streams of the other clients are not found either
+		stream, exists := streams.get(c.Params("id"), requestOwner(c))
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("stream %s not found", c.Params("id")))
+		}
+
+		offset := c.QueryInt("offset", 0)
+		if last := c.Get("Last-Event-ID"); last != "" {
+			if i, err := strconv.Atoi(last); err == nil {
+				offset = i + 1
+			}
+		}
+		if offset < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("invalid offset %d", offset))
+		}
+
+		c.Context().SetContentType("text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("Transfer-Encoding", "chunked")
+		c.Set(streamIDHeader, stream.id)
+
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			stream.writeTo(w, offset)
+		}))
+		return nil
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+
+	"github.com/gofiber/fiber/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resumable streams", func() {
+	var app *fiber.App
+	var stream *bufferedStream
+	BeforeEach(func() {
+		app = fiber.New()
+		app.Get("/streams/:id", resumeStreamEndpoint())
+
+		stream = streams.create("alice")
+		for _, text := range []string{"hel", "lo"} {
+			stream.append(OpenAIResponse{ID: stream.id, Choices: []Choice{{Delta: &Message{Content: text}}}})
+		}
+		streams.complete(stream)
+	})
+	resume := func(bearer, lastEventID string, query ...string) (int, string) {
+		url := "/streams/" + stream.id
+		if len(query) > 0 {
+			url += "?" + query[0]
+		}
+		req := httptest.NewRequest("GET", url, nil)
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := app.Test(req)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		return resp.StatusCode, string(body)
+	}
+
+	It("resumes after the last event received", func() {
+		status, body := resume("alice", "0")
+		Expect(status).To(Equal(fiber.StatusOK))
+		Expect(body).ToNot(ContainSubstring(`"hel"`))
+		// the id is in the frame of the event
+		Expect(body).To(HavePrefix("event: data\nid: 1\ndata: {"))
+		Expect(body).To(ContainSubstring(`"lo"`))
+	})
+	It("replays the whole stream", func() {
+		status, body := resume("alice", "")
+		Expect(status).To(Equal(fiber.StatusOK))
+		Expect(body).To(ContainSubstring("id: 0\n"))
+		Expect(body).To(ContainSubstring("id: 1\n"))
+	})
+	It("rejects the negative offsets", func() {
+		status, _ := resume("alice", "", "offset=-1")
+		Expect(status).To(Equal(fiber.StatusBadRequest))
+		status, _ = resume("alice", "-5")
+		Expect(status).To(Equal(fiber.StatusBadRequest))
+		// before the first event
+		status, body := resume("alice", "-1")
+		Expect(status).To(Equal(fiber.StatusOK))
+		Expect(body).To(ContainSubstring("id: 0\n"))
+
+		events, _, _ := stream.from(-3)
+		Expect(events).To(HaveLen(2))
+	})
+	It("doesn't let the other clients resume the stream", func() {
+		status, _ := resume("bob", "")
+		Expect(status).To(Equal(fiber.StatusNotFound))
+		status, _ = resume("", "")
+		Expect(status).To(Equal(fiber.StatusNotFound))
+	})
+})
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RetryConfig defines how backend errors are retried before being returned
+// to the client
+type RetryConfig struct {
+	// Attempts is the maximum number of retries, 0 disables retrying
+	Attempts int `yaml:"attempts"`
+	// Backoff is the wait before the first retry in milliseconds, doubled at each retry
+	Backoff int `yaml:"backoff"`
+	// Deadline is the maximum time in seconds spent retrying, 0 means no limit
+	Deadline int `yaml:"deadline"`
+	// Errors is a list of regular expressions matching the errors to retry.
+	// If empty, all the prediction errors are retried
+	Errors []string `yaml:"errors"`
+
+	// errors compiled by compile
+	patterns []*regexp.Regexp
+}
+
+// sleep waits between the attempts, replaced in the tests
+var sleep = time.Sleep
+
+// compile compiles the errors patterns, when the config is loaded
+func (r *RetryConfig) compile() error {
+	r.patterns = nil
+	for _, e := range r.Errors {
+		reg, err := regexp.Compile(e)
+		if err != nil {
+			return fmt.Errorf("invalid retry error pattern %q: %w", e, err)
+		}
+		r.patterns = append(r.patterns, reg)
+	}
+	return nil
+}
+
+func (r RetryConfig) retryable(err error) bool {
+	if len(r.Errors) == 0 {
+		return true
+	}
+	for _, reg := range r.patterns {
+		if reg.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry calls fn until it succeeds, the error is not retryable, or the
+// attempts or the deadline are exhausted. canRetry is consulted before each
+// retry, and can be nil.
+func withRetry(r RetryConfig, fn func() error, canRetry func() bool) error {
+	start := time.Now()
+	backoff := time.Duration(r.Backoff) * time.Millisecond
+
+	err := fn()
+	for i := 0; err != nil && i < r.Attempts; i++ {
+		if !r.retryable(err) || (canRetry != nil && !canRetry()) {
+			return err
+		}
+		if r.Deadline != 0 && time.Since(start)+backoff > time.Duration(r.Deadline)*time.Second {
+			log.Debug().Msgf("Retry deadline exceeded, giving up: %s", err.Error())
+			return err
+		}
+
+		log.Debug().Msgf("Backend error, retrying in %s (%d/%d): %s", backoff, i+1, r.Attempts, err.Error())
+		sleep(backoff)
+		backoff *= 2
+
+		err = fn()
+	}
+	return err
+}
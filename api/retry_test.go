@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retrying backend errors", func() {
+	var waits []time.Duration
+	BeforeEach(func() {
+		waits = nil
+		sleep = func(d time.Duration) { waits = append(waits, d) }
+		DeferCleanup(func() { sleep = time.Sleep })
+	})
+	// failing returns a function failing with err the first times
+	failing := func(times int, err error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= times {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+	compiled := func(r RetryConfig) RetryConfig {
+		ExpectWithOffset(1, r.compile()).To(Succeed())
+		return r
+	}
+
+	It("doubles the backoff at each retry", func() {
+		fn, calls := failing(3, errors.New("failed to allocate"))
+		Expect(withRetry(compiled(RetryConfig{Attempts: 3, Backoff: 100}), fn, nil)).To(Succeed())
+		Expect(*calls).To(Equal(4))
+		Expect(waits).To(Equal([]time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond}))
+	})
+	It("returns the error once the attempts are exhausted", func() {
+		fn, calls := failing(5, errors.New("failed to allocate"))
+		Expect(withRetry(compiled(RetryConfig{Attempts: 2}), fn, nil)).To(MatchError("failed to allocate"))
+		Expect(*calls).To(Equal(3))
+	})
+	It("retries only the errors matching the patterns", func() {
+		r := compiled(RetryConfig{Attempts: 3, Errors: []string{"^failed to alloc"}})
+		fn, calls := failing(1, errors.New("failed to allocate"))
+		Expect(withRetry(r, fn, nil)).To(Succeed())
+		Expect(*calls).To(Equal(2))
+
+		fn, calls = failing(1, errors.New("invalid prompt"))
+		Expect(withRetry(r, fn, nil)).To(MatchError("invalid prompt"))
+		Expect(*calls).To(Equal(1))
+	})
+	It("gives up past the deadline", func() {
+		fn, calls := failing(5, errors.New("failed to allocate"))
+		Expect(withRetry(compiled(RetryConfig{Attempts: 5, Backoff: 2000, Deadline: 1}), fn, nil)).To(HaveOccurred())
+		Expect(*calls).To(Equal(1))
+		Expect(waits).To(BeEmpty())
+	})
+	It("doesn't retry once the stream started", func() {
+		fn, calls := failing(1, errors.New("failed to allocate"))
+		Expect(withRetry(compiled(RetryConfig{Attempts: 3}), fn, func() bool { return false })).To(HaveOccurred())
+		Expect(*calls).To(Equal(1))
+	})
+	It("rejects the invalid patterns when loading the config", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "model.yaml")
+		Expect(os.WriteFile(file, []byte("name: model\nretry:\n  attempts: 1\n  errors:\n  - \"(unclosed\"\n"), 0600)).To(Succeed())
+		_, err := ReadConfig(file)
+		Expect(err).To(MatchError(ContainSubstring("invalid retry error pattern")))
+
+		cm := NewConfigMerger()
+		Expect(cm.LoadConfigs(filepath.Dir(file))).To(Succeed())
+		Expect(cm.snapshot()).ToNot(HaveKey("model"))
+	})
+})
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/go-skynet/LocalAI/pkg/schedule"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LoadAction loads a model in memory
+	LoadAction = "load"
+	// UnloadAction frees a model from memory
+	UnloadAction = "unload"
+	// DownloadAction downloads a model file if it was updated upstream
+	DownloadAction = "download"
+)
+
+// ScheduledJob is an action on a model run on a cron schedule
+type ScheduledJob struct {
+	Name   string `yaml:"name"`
+	Cron   string `yaml:"cron"`
+	Action string `yaml:"action"`
+	// Model is the name of a model config, or a file in the models path
+	Model string `yaml:"model"`
+	// URL is the location of the model file, for the download action
+	URL string `yaml:"url"`
+
+	schedule *schedule.Cron
+}
+
+func ReadScheduleFile(file string) ([]*ScheduledJob, error) {
+	jobs := []*ScheduledJob{}
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schedule file: %w", err)
+	}
+	if err := yaml.Unmarshal(f, &jobs); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal schedule file: %w", err)
+	}
+
+	for _, j := range jobs {
+		j.schedule, err = schedule.Parse(j.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", j.Name, err)
+		}
+		switch j.Action {
+		case LoadAction, UnloadAction:
+		case DownloadAction:
+			if j.URL == "" {
+				return nil, fmt.Errorf("job %s: download requires an url", j.Name)
+			}
+		default:
+			return nil, fmt.Errorf("job %s: unknown action %q", j.Name, j.Action)
+		}
+		if j.Model == "" {
+			return nil, fmt.Errorf("job %s: model is required", j.Name)
+		}
+	}
+
+	return jobs, nil
+}
+
+type scheduler struct {
+	jobs         []*ScheduledJob
+	cm           ConfigMerger
+	loader       *model.ModelLoader
+	threads, ctx int
+	f16          bool
+}
+
+// run checks the jobs every minute, until the context is canceled
+func (s *scheduler) run(ctx context.Context) {
+	for {
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+
+		now = time.Now()
+		for _, j := range s.jobs {
+			if !j.schedule.Matches(now) {
+				continue
+			}
+			log.Info().Msgf("Running scheduled job %s: %s %s", j.Name, j.Action, j.Model)
+			if err := s.runJob(ctx, j); err != nil {
+				log.Error().Msgf("Scheduled job %s failed: %s", j.Name, err.Error())
+			}
+		}
+	}
+}
+
+// config returns the config of the model of the job, as a request would get it
+func (s *scheduler) config(j *ScheduledJob) Config {
+	if cfg, exists := s.cm.get(j.Model); exists {
+		if cfg.Threads == 0 {
+			cfg.Threads = s.threads
+		}
+		return cfg
+	}
+	return Config{
+		OpenAIRequest: defaultRequest(j.Model),
+		ContextSize:   s.ctx,
+		Threads:       s.threads,
+		F16:           s.f16,
+	}
+}
+
+func (s *scheduler) runJob(ctx context.Context, j *ScheduledJob) error {
+	cfg := s.config(j)
+
+	switch j.Action {
+	case LoadAction:
+		defer lowMemoryLock(s.loader)()
+		_, err := loadModel(s.loader, cfg)
+		return err
+	case UnloadAction:
+		// freed once the running requests complete
+		return s.loader.UnloadModel(cfg.Model)
+	case DownloadAction:
+		_, err := updateModel(ctx, s.loader, cfg.Model, j.URL, cfg.SHA256)
+		return err
+	}
+	return nil
+}
+
+// updateModel downloads the model file from url if it was updated upstream.
+// The new file is picked up the next time the model is loaded. With checksum,
+// the sha256 of the config, the files not matching it are discarded.
+func updateModel(ctx context.Context, loader *model.ModelLoader, modelFile, url, checksum string) (bool, error) {
+	updated, err := downloadIfModified(ctx, url, filepath.Join(loader.ModelPath, modelFile), checksum)
+	if err != nil || !updated {
+		return false, err
+	}
+	log.Info().Msgf("Model %s updated from %s", modelFile, url)
+
+	// the running requests complete with the previous file, if loaded
+	loader.UnloadModel(modelFile)
+	return true, nil
+}
+
+// downloadClient downloads the model files. They are large, so the downloads
+// are not limited in time, only the waits for the server are
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// downloadStallTimeout aborts the downloads not receiving anything for as
+// long, replaced in the tests
+var downloadStallTimeout = time.Minute
+
+// stallReader resets the stall timer of a download on every read
+type stallReader struct {
+	io.Reader
+	timer *time.Timer
+}
+
+func (r stallReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.timer.Reset(downloadStallTimeout)
+	return n, err
+}
+
+// downloadIfModified downloads url to dst, unless the remote file is not
+// newer than dst. dst is replaced only if the download matches the checksum,
+// when set. It returns true if the file was downloaded. The download is
+// aborted when ctx is canceled, or when it stalls.
+func downloadIfModified(ctx context.Context, url, dst, checksum string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stall := time.AfterFunc(downloadStallTimeout, cancel)
+	defer stall.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(dst); err == nil {
+		req.Header.Set("If-Modified-Since", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("failed downloading %s: %s", url, resp.Status)
+	}
+
+	// download next to the destination, and swap the files only when complete
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".download")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), stallReader{Reader: resp.Body, timer: stall}); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); checksum != "" && !strings.EqualFold(sum, checksum) {
+		return false, fmt.Errorf("the download of %s has checksum %s, expected %s", url, sum, checksum)
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		os.Chtimes(tmp.Name(), lastModified, lastModified)
+	}
+
+	return true, os.Rename(tmp.Name(), dst)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Model downloads", func() {
+	var dst string
+	var hang chan struct{}
+	var source *httptest.Server
+	BeforeEach(func() {
+		dst = filepath.Join(GinkgoT().TempDir(), "model.bin")
+		Expect(os.WriteFile(dst, []byte("hello"), 0600)).To(Succeed())
+
+		// sends the beginning of the file, then stalls
+		hang = make(chan struct{})
+		source = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+			w.(http.Flusher).Flush()
+			<-hang
+		}))
+		DeferCleanup(source.Close)
+		DeferCleanup(func() { close(hang) })
+	})
+
+	It("aborts the downloads stalling", func() {
+		downloadStallTimeout = 100 * time.Millisecond
+		DeferCleanup(func() { downloadStallTimeout = time.Minute })
+
+		updated, err := downloadIfModified(context.Background(), source.URL, dst, "")
+		Expect(err).To(HaveOccurred())
+		Expect(updated).To(BeFalse())
+		content, err := os.ReadFile(dst)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(Equal("hello"))
+	})
+	It("aborts the downloads once canceled", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		updated, err := downloadIfModified(ctx, source.URL, dst, "")
+		Expect(err).To(MatchError(ContainSubstring("context")))
+		Expect(updated).To(BeFalse())
+	})
+})
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SessionParameters are the generation parameters of the last request of a session
+type SessionParameters struct {
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+	TopK        int     `json:"top_k"`
+	Maxtokens   int     `json:"max_tokens"`
+	Seed        int     `json:"seed"`
+}
+
+// sessions not used for this long are dropped
+const sessionTTL = 24 * time.Hour
+
+// maximum number of sessions kept in memory
+const maxSessions = 1000
+
+// Session is a conversation kept server-side: the messages of the previous
+// requests are prepended to the ones of each new request, and the model and
+// the parameters of the last request are the defaults of the next ones.
+type Session struct {
+	ID         string            `json:"id"`
+	Model      string            `json:"model"`
+	Messages   []Message         `json:"messages"`
+	Parameters SessionParameters `json:"parameters"`
+	Created    int64             `json:"created"`
+	Updated    int64             `json:"updated"`
+
+	// owner is the credential of the client that created the session, the
+	// only one allowed to use it
+	owner string
+	mu    sync.Mutex
+}
+
+// has returns true if the session contains the message
+func (s *Session) has(m Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range s.Messages {
+		if message == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Session) history() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.Messages...)
+}
+
+// defaults sets the model and the parameters of the session on the request,
+// where it doesn't set them
+func (s *Session) defaults(input *OpenAIRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if input.Model == "" {
+		input.Model = s.Model
+	}
+	if input.Temperature == 0 {
+		input.Temperature = s.Parameters.Temperature
+	}
+	if input.TopP == 0 {
+		input.TopP = s.Parameters.TopP
+	}
+	if input.TopK == 0 {
+		input.TopK = s.Parameters.TopK
+	}
+	if input.Maxtokens == 0 {
+		input.Maxtokens = s.Parameters.Maxtokens
+	}
+	if input.Seed == 0 {
+		input.Seed = s.Parameters.Seed
+	}
+}
+
+func (s *Session) expired(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return now.Sub(time.Unix(s.Updated, 0)) > sessionTTL
+}
+
+// record appends the messages of a request and the reply of the model
+func (s *Session) record(config *Config, messages []Message, reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Messages = append(s.Messages, messages...)
+	s.Messages = append(s.Messages, Message{Role: "assistant", Content: reply})
+	s.Model = config.Model
+	s.Parameters = SessionParameters{
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        config.TopK,
+		Maxtokens:   config.Maxtokens,
+		Seed:        config.Seed,
+	}
+	s.Updated = time.Now().Unix()
+}
+
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+var sessions = &sessionStore{sessions: make(map[string]*Session)}
+
+// newSessionID returns a random ID of 128 bits, which can't be guessed
+func newSessionID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// get returns the session of owner with the given id. If it doesn't exist,
+// it is created if create is true, and not found otherwise
+func (s *sessionStore) get(id, owner string, create bool) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	session, exists := s.sessions[id]
+	if exists && session.expired(now) {
+		delete(s.sessions, id)
+		exists = false
+	}
+	if exists {
+		// the sessions of the other clients are not found either
+		if !sameOwner(session.owner, owner) {
+			return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("session %s not found", id))
+		}
+		return session, nil
+	}
+	if !create {
+		return nil, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("session %s not found", id))
+	}
+
+	if len(s.sessions) >= maxSessions {
+		s.dropExpired(now)
+	}
+	if len(s.sessions) >= maxSessions {
+		return nil, fiber.NewError(fiber.StatusTooManyRequests, "too many sessions, delete some or retry later")
+	}
+	session = &Session{ID: id, Created: now.Unix(), Updated: now.Unix(), owner: owner}
+	s.sessions[id] = session
+	return session, nil
+}
+
+// create returns a new session of owner, with a random ID
+func (s *sessionStore) create(owner string) (*Session, error) {
+	return s.get(newSessionID(), owner, true)
+}
+
+// dropExpired drops the expired sessions, s.mu must be held
+func (s *sessionStore) dropExpired(now time.Time) {
+	for id, session := range s.sessions {
+		if session.expired(now) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// lookup returns the session of owner with the given id, if it exists
+func (s *sessionStore) lookup(id, owner string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, exists := s.sessions[id]
+	if !exists || session.expired(time.Now()) || !sameOwner(session.owner, owner) {
+		return nil, false
+	}
+	return session, true
+}
+
+func (s *sessionStore) delete(id, owner string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.sessions[id]; !exists || !sameOwner(s.sessions[id].owner, owner) {
+		return false
+	}
+	delete(s.sessions, id)
+	return true
+}
+
+func exportSessionEndpoint() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		session, exists := sessions.lookup(c.Params("id"), requestOwner(c))
+		if !exists {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("session %s not found", c.Params("id")))
+		}
+
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		return c.JSON(session)
+	}
+}
+
+// importSessionEndpoint creates a new session from an exported one
+func importSessionEndpoint() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		imported := new(Session)
+		if err := c.BodyParser(imported); err != nil {
+			return err
+		}
+
+		session, err := sessions.create(requestOwner(c))
+		if err != nil {
+			return err
+		}
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		session.Model = imported.Model
+		session.Messages = imported.Messages
+		session.Parameters = imported.Parameters
+		if imported.Created != 0 {
+			session.Created = imported.Created
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(session)
+	}
+}
+
+// createSessionEndpoint creates an empty session. Without API keys, the
+// clients can't pick the IDs of their sessions: they are created here
+func createSessionEndpoint() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		session, err := sessions.create(requestOwner(c))
+		if err != nil {
+			return err
+		}
+
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		return c.Status(fiber.StatusCreated).JSON(session)
+	}
+}
+
+func deleteSessionEndpoint() func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if !sessions.delete(c.Params("id"), requestOwner(c)) {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("session %s not found", c.Params("id")))
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
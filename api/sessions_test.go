@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sessions", func() {
+	var store *sessionStore
+	BeforeEach(func() {
+		store = &sessionStore{sessions: make(map[string]*Session)}
+	})
+
+	It("keeps the sessions of each client apart", func() {
+		session, err := store.get("s1", "alice", true)
+		Expect(err).ToNot(HaveOccurred())
+		again, err := store.get("s1", "alice", true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(again).To(BeIdenticalTo(session))
+
+		_, err = store.get("s1", "bob", true)
+		Expect(err).To(MatchError(fiber.NewError(fiber.StatusNotFound, "session s1 not found")))
+		_, exists := store.lookup("s1", "bob")
+		Expect(exists).To(BeFalse())
+		Expect(store.delete("s1", "bob")).To(BeFalse())
+		Expect(store.delete("s1", "alice")).To(BeTrue())
+	})
+	It("drops the sessions not used for a while", func() {
+		session, err := store.get("s1", "alice", true)
+		Expect(err).ToNot(HaveOccurred())
+		session.Updated = time.Now().Add(-sessionTTL - time.Minute).Unix()
+
+		_, exists := store.lookup("s1", "alice")
+		Expect(exists).To(BeFalse())
+		renewed, err := store.get("s1", "alice", true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(renewed).ToNot(BeIdenticalTo(session))
+	})
+	It("only finds the sessions it doesn't create", func() {
+		_, err := store.get("s1", "", false)
+		Expect(err).To(MatchError(fiber.NewError(fiber.StatusNotFound, "session s1 not found")))
+
+		session, err := store.create("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(session.ID).To(MatchRegexp("^[0-9a-f]{32}$"))
+		found, err := store.get(session.ID, "", false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(found).To(BeIdenticalTo(session))
+
+		other, err := store.create("")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(other.ID).ToNot(Equal(session.ID))
+	})
+	It("limits the number of sessions", func() {
+		for i := 0; i < maxSessions; i++ {
+			_, err := store.get(fmt.Sprint("s", i), "alice", true)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		_, err := store.get("one more", "alice", true)
+		Expect(err).To(MatchError(ContainSubstring("too many sessions")))
+
+		// the expired ones make room
+		for _, session := range store.sessions {
+			session.Updated = time.Now().Add(-sessionTTL - time.Minute).Unix()
+			break
+		}
+		_, err = store.get("one more", "alice", true)
+		Expect(err).ToNot(HaveOccurred())
+	})
+	It("sets its model and parameters on the requests", func() {
+		session := &Session{Model: "testmodel", Parameters: SessionParameters{Temperature: 0.2, TopK: 40, Seed: 7}}
+		input := &OpenAIRequest{TopK: 10}
+		session.defaults(input)
+		Expect(input.Model).To(Equal("testmodel"))
+		Expect(input.Temperature).To(Equal(0.2))
+		Expect(input.TopK).To(Equal(10))
+		Expect(input.Seed).To(Equal(7))
+	})
+	It("finds the messages", func() {
+		session := &Session{Messages: []Message{{Role: "system", Content: "Triage the ticket"}}}
+		Expect(session.has(Message{Role: "system", Content: "Triage the ticket"})).To(BeTrue())
+		Expect(session.has(Message{Role: "user", Content: "Triage the ticket"})).To(BeFalse())
+	})
+	It("records the replies", func() {
+		session := &Session{}
+		session.record(&Config{OpenAIRequest: OpenAIRequest{Model: "testmodel", Seed: 7}}, []Message{{Role: "user", Content: "hi"}}, "hello")
+		Expect(session.history()).To(Equal([]Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}))
+		Expect(session.Model).To(Equal("testmodel"))
+		Expect(session.Parameters.Seed).To(Equal(7))
+	})
+})
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/go-skynet/LocalAI/pkg/vector"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+type SimilarityRequest struct {
+	// Query is the text compared against the inputs and the vectors
+	Query string `json:"query"`
+	// Vectors are precomputed embeddings to compare the query against
+	Vectors [][]float32 `json:"vectors"`
+}
+
+type SimilarityItem struct {
+	Index      int     `json:"index"`
+	Similarity float64 `json:"similarity"`
+	Object     string  `json:"object"`
+}
+
+type SimilarityResponse struct {
+	Object string           `json:"object"`
+	Model  string           `json:"model,omitempty"`
+	Data   []SimilarityItem `json:"data"`
+}
+
+// similarityEndpoint computes the cosine similarity between the embeddings of
+// the query and the ones of the texts in input, followed by the given vectors.
+func similarityEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, threads, ctx int, f16 bool) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		config, input, err := readConfig(cm, c, loader, debug, threads, ctx, f16)
+		if err != nil {
+			return fmt.Errorf("failed reading parameters from request:%w", err)
+		}
+
+		req := new(SimilarityRequest)
+		if err := c.BodyParser(req); err != nil {
+			return err
+		}
+
+		if req.Query == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "query is required")
+		}
+
+		defer useModel(loader, config)()
+
+		log.Debug().Msgf("Parameter Config: %+v", config)
+
+		embed := func(s string) ([]float32, error) {
+			embedFn, err := ModelEmbedding(s, []int{}, loader, *config)
+			if err != nil {
+				return nil, err
+			}
+			embeddings, err := embedFn()
+			if err != nil {
+				return nil, err
+			}
+			return reduceEmbeddings(config, embeddings)
+		}
+
+		query, err := embed(req.Query)
+		if err != nil {
+			return err
+		}
+
+		vectors := [][]float32{}
+		for _, s := range config.InputStrings {
+			e, err := embed(s)
+			if err != nil {
+				return err
+			}
+			vectors = append(vectors, e)
+		}
+		vectors = append(vectors, req.Vectors...)
+
+		items := []SimilarityItem{}
+		for i, v := range vectors {
+			s, err := vector.Cosine(query, v)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("item %d: %s", i, err.Error()))
+			}
+			items = append(items, SimilarityItem{Index: i, Similarity: s, Object: "similarity"})
+		}
+
+		return c.JSON(SimilarityResponse{
+			Object: "list",
+			Model:  input.Model,
+			Data:   items,
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	TokenGranularity    = "token"
+	WordGranularity     = "word"
+	IntervalGranularity = "interval"
+)
+
+// StreamOptions controls how the generated tokens are grouped in SSE events
+type StreamOptions struct {
+	// Granularity is one of "token" (default), "word" or "interval"
+	Granularity string `json:"granularity" yaml:"granularity"`
+	// FlushInterval is the interval in milliseconds between events with the "interval" granularity
+	FlushInterval int `json:"flush_interval_ms" yaml:"flush_interval_ms"`
+	// IncludeUsage sends an additional chunk with the token usage before closing the stream
+	IncludeUsage bool `json:"include_usage" yaml:"include_usage"`
+}
+
+// streamChunker buffers the tokens coming from the backend and decides when
+// they have to be sent to the client.
+type streamChunker struct {
+	granularity string
+	interval    time.Duration
+	buf         string
+	last        time.Time
+	// now is time.Now, replaced in the tests
+	now func() time.Time
+}
+
+func newStreamChunker(opts *StreamOptions) *streamChunker {
+	c := &streamChunker{granularity: TokenGranularity, last: time.Now(), now: time.Now}
+	if opts == nil {
+		return c
+	}
+
+	switch opts.Granularity {
+	case WordGranularity:
+		c.granularity = WordGranularity
+	case IntervalGranularity:
+		c.granularity = IntervalGranularity
+		c.interval = time.Duration(opts.FlushInterval) * time.Millisecond
+	}
+	return c
+}
+
+// add buffers a token and returns the text to send, if any
+func (c *streamChunker) add(token string) (string, bool) {
+	c.buf += token
+
+	switch c.granularity {
+	case WordGranularity:
+		i := strings.LastIndexAny(c.buf, " \t\n")
+		if i == -1 {
+			return "", false
+		}
+		out := c.buf[:i+1]
+		c.buf = c.buf[i+1:]
+		return out, true
+	case IntervalGranularity:
+		if c.now().Sub(c.last) < c.interval {
+			return "", false
+		}
+	}
+
+	return c.flush(), true
+}
+
+// due returns the buffered text once the interval elapsed, with the
+// "interval" granularity. It is called on a timer, for the text not to wait
+// for the next token of a slow backend.
+func (c *streamChunker) due() (string, bool) {
+	if c.granularity != IntervalGranularity || c.buf == "" || c.now().Sub(c.last) < c.interval {
+		return "", false
+	}
+	return c.flush(), true
+}
+
+// flush returns whatever is left in the buffer
+func (c *streamChunker) flush() string {
+	out := c.buf
+	c.buf = ""
+	c.last = c.now()
+	return out
+}
+
+// streamChat consumes the tokens produced by the backend and emits the chat
+// completion chunks, honoring the stream options of the request. It returns
+// the whole generated text and the finish reason.
+func streamChat(input *OpenAIRequest, config *Config, responses chan OpenAIResponse, emit func(OpenAIResponse)) (string, string) {
+	chunker := newStreamChunker(config.StreamOptions)
+	send := func(text string) {
+		emit(OpenAIResponse{
+			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Choices: []Choice{{Delta: &Message{Role: "assistant", Content: text}}},
+			Object:  "chat.completion.chunk",
+		})
+	}
+
+	var tick <-chan time.Time
+	if chunker.granularity == IntervalGranularity && chunker.interval > 0 {
+		ticker := time.NewTicker(chunker.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	generated := ""
+	tokens := 0
+	finishReason := "stop"
+	for done := false; !done; {
+		select {
+		case ev, ok := <-responses:
+			switch {
+			case !ok:
+				done = true
+			case ev.Choices[0].FinishReason != "":
+				finishReason = ev.Choices[0].FinishReason
+			default:
+				tokens++
+				generated += ev.Choices[0].Delta.Content
+				if text, ok := chunker.add(ev.Choices[0].Delta.Content); ok {
+					send(text)
+				}
+			}
+		case <-tick:
+			if text, ok := chunker.due(); ok {
+				send(text)
+			}
+		}
+	}
+	if text := chunker.flush(); text != "" {
+		send(text)
+	}
+
+	emit(OpenAIResponse{
+		Model:      input.Model, // we have to return what the user sent here, due to OpenAI spec.
+		Choices:    []Choice{{FinishReason: finishReason}},
+		Object:     "chat.completion.chunk",
+		Metadata:   generationMetadata(config, []Choice{{Text: generated}}),
+		Accounting: config.stats.accounting(),
+	})
+
+	if config.StreamOptions != nil && config.StreamOptions.IncludeUsage {
+		emit(OpenAIResponse{
+			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Choices: []Choice{},
+			Object:  "chat.completion.chunk",
+			Usage: OpenAIUsage{
+				CompletionTokens: tokens,
+				TotalTokens:      tokens,
+			},
+		})
+	}
+
+	return generated, finishReason
+}
+
+func writeEvent(w *bufio.Writer, ev interface{}) error {
+	return writeEventWithID(w, "", ev)
+}
+
+func writeEventWithID(w *bufio.Writer, id string, ev interface{}) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(ev)
+
+	if id != "" {
+		// the id belongs to the frame of the event
+		fmt.Fprintf(w, "event: data\nid: %s\n", id)
+	} else {
+		fmt.Fprintf(w, "event: data\n\n")
+	}
+	fmt.Fprintf(w, "data: %v\n\n", buf.String())
+	log.Debug().Msgf("Sending chunk: %s", buf.String())
+	return w.Flush()
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream chunking", func() {
+	var now time.Time
+	clock := func(c *streamChunker) *streamChunker {
+		now = time.Now()
+		c.last = now
+		c.now = func() time.Time { return now }
+		return c
+	}
+	// sent returns the text to send, failing if there is none
+	sent := func(text string, ok bool) string {
+		ExpectWithOffset(1, ok).To(BeTrue())
+		return text
+	}
+
+	It("sends every token by default", func() {
+		c := newStreamChunker(nil)
+		Expect(sent(c.add("hel"))).To(Equal("hel"))
+		Expect(sent(c.add("lo"))).To(Equal("lo"))
+		Expect(c.flush()).To(BeEmpty())
+	})
+	It("sends whole words", func() {
+		c := newStreamChunker(&StreamOptions{Granularity: WordGranularity})
+		text, ok := c.add("hel")
+		Expect(ok).To(BeFalse())
+		Expect(text).To(BeEmpty())
+		Expect(sent(c.add("lo wor"))).To(Equal("hello "))
+		Expect(sent(c.add("ld\n"))).To(Equal("world\n"))
+		c.add("end")
+		Expect(c.flush()).To(Equal("end"))
+	})
+	It("sends the tokens at intervals", func() {
+		c := clock(newStreamChunker(&StreamOptions{Granularity: IntervalGranularity, FlushInterval: 100}))
+		_, ok := c.add("hel")
+		Expect(ok).To(BeFalse())
+		now = now.Add(50 * time.Millisecond)
+		_, ok = c.add("lo")
+		Expect(ok).To(BeFalse())
+		now = now.Add(50 * time.Millisecond)
+		Expect(sent(c.add(" world"))).To(Equal("hello world"))
+	})
+	It("sends the buffered tokens once the interval elapsed, without a new token", func() {
+		c := clock(newStreamChunker(&StreamOptions{Granularity: IntervalGranularity, FlushInterval: 100}))
+		_, ok := c.due()
+		Expect(ok).To(BeFalse())
+		c.add("hello")
+		_, ok = c.due()
+		Expect(ok).To(BeFalse())
+		now = now.Add(100 * time.Millisecond)
+		Expect(sent(c.due())).To(Equal("hello"))
+		_, ok = c.due()
+		Expect(ok).To(BeFalse())
+	})
+	It("doesn't hold the text of a slow stream past the interval", func() {
+		responses := make(chan OpenAIResponse)
+		token := func(s string) OpenAIResponse {
+			return OpenAIResponse{Choices: []Choice{{Delta: &Message{Content: s}}}}
+		}
+		config := &Config{}
+		config.StreamOptions = &StreamOptions{Granularity: IntervalGranularity, FlushInterval: 20}
+
+		chunks := make(chan string, 10)
+		done := make(chan string)
+		go func() {
+			generated, _ := streamChat(&OpenAIRequest{}, config, responses, func(ev OpenAIResponse) {
+				if ev.Choices[0].Delta != nil {
+					chunks <- ev.Choices[0].Delta.Content
+				}
+			})
+			done <- generated
+		}()
+
+		responses <- token("hello")
+		Eventually(chunks).Should(Receive(Equal("hello")))
+		responses <- token(" world")
+		close(responses)
+		Eventually(chunks).Should(Receive(Equal(" world")))
+		Eventually(done).Should(Receive(Equal("hello world")))
+	})
+})
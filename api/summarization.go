@@ -0,0 +1,176 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/go-skynet/LocalAI/pkg/text"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultSummarizationPrompt = `Write a concise summary of the following text:
+
+%s
+
+Summary:`
+
+const (
+	// rough estimate of the characters per token, on the safe side
+	charsPerToken = 3
+	// tokens reserved for the summarization prompt
+	summarizationPromptTokens = 64
+	// maximum number of times summaries are merged together
+	maxSummarizationDepth = 5
+	// maximum number of chunks summarized at once
+	summarizationWorkers = 4
+)
+
+type SummarizationResponse struct {
+	Object  string `json:"object"`
+	Model   string `json:"model,omitempty"`
+	Summary string `json:"summary"`
+	// Chunks is the number of chunks the input was split into
+	Chunks int `json:"chunks"`
+	// Truncated is true if the summaries didn't shrink enough to be merged
+	// whole, and the summary was made from their beginning only
+	Truncated bool `json:"truncated"`
+}
+
+// summarizationEndpoint summarizes texts of any length: the input is split in
+// chunks fitting the context of the model, each chunk is summarized, and the
+// summaries are merged recursively until a single summary is left.
+func summarizationEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, threads, ctx int, f16 bool) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		config, input, err := readConfig(cm, c, loader, debug, threads, ctx, f16)
+		if err != nil {
+			return fmt.Errorf("failed reading parameters from request:%w", err)
+		}
+
+		if len(config.InputStrings) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "input is required")
+		}
+
+		contextSize := config.ContextSize
+		if contextSize == 0 {
+			contextSize = 512
+		}
+		// The summaries must leave room for the text to summarize
+		if input.Maxtokens == 0 || config.Maxtokens > contextSize/2 {
+			config.Maxtokens = contextSize / 4
+		}
+		chunkSize := (contextSize - config.Maxtokens - summarizationPromptTokens) * charsPerToken
+		if chunkSize <= 0 {
+			chunkSize = contextSize * charsPerToken / 2
+		}
+
+		log.Debug().Msgf("Parameter Config: %+v", config)
+
+		// one generation per chunk, regardless of what was requested
+		req := *input
+		req.N = 1
+
+		summarize := func(s string) (string, error) {
+			predInput := fmt.Sprintf(defaultSummarizationPrompt, s)
+			if config.TemplateConfig.Summarization != "" {
+				templatedInput, err := loader.TemplatePrefix(config.TemplateConfig.Summarization, struct {
+					Input string
+				}{Input: s})
+				if err == nil {
+					predInput = templatedInput
+				}
+			}
+
+			choices, err := ComputeChoices(predInput, &req, config, loader, func(s string, c *[]Choice) {
+				*c = append(*c, Choice{Text: s})
+			}, nil)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(choices[0].Text), nil
+		}
+
+		chunks := text.Split(strings.Join(config.InputStrings, "\n\n"), chunkSize)
+		log.Debug().Msgf("Summarizing %d chunks of %d characters", len(chunks), chunkSize)
+
+		summary, truncated, err := summarizeChunks(chunks, chunkSize, summarize)
+		if err != nil {
+			return err
+		}
+		if truncated {
+			log.Warn().Msgf("The summaries of %s didn't shrink to %d characters, summarized their beginning only", input.Model, chunkSize)
+		}
+
+		return c.JSON(SummarizationResponse{
+			Object:    "summary",
+			Model:     input.Model,
+			Summary:   summary,
+			Chunks:    len(chunks),
+			Truncated: truncated,
+		})
+	}
+}
+
+// summarizeChunks summarizes the chunks, then merges the summaries until a
+// single one is left. It returns true if the summaries stopped shrinking, and
+// only their beginning was summarized.
+func summarizeChunks(chunks []string, chunkSize int, summarize func(string) (string, error)) (string, bool, error) {
+	summaries, err := summarizeAll(chunks, summarize)
+	if err != nil {
+		return "", false, err
+	}
+
+	for depth := 0; len(summaries) > 1; depth++ {
+		merged := strings.Join(summaries, "\n\n")
+		if len(merged) <= chunkSize || depth == maxSummarizationDepth {
+			// last merge. If the summaries stopped shrinking, keep only what fits
+			truncated := false
+			if len(merged) > chunkSize {
+				merged = text.Split(merged, chunkSize)[0]
+				truncated = true
+			}
+			summary, err := summarize(merged)
+			return summary, truncated, err
+		}
+
+		summaries, err = summarizeAll(text.Split(merged, chunkSize), summarize)
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	if len(summaries) == 0 {
+		return "", false, nil
+	}
+	return summaries[0], false, nil
+}
+
+// summarizeAll summarizes the chunks in parallel, a few at a time: the
+// backends take care of serializing the requests if they can't handle them
+// concurrently
+func summarizeAll(chunks []string, summarize func(string) (string, error)) ([]string, error) {
+	summaries := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	workers := make(chan struct{}, summarizationWorkers)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			summaries[i], errs[i] = summarize(chunks[i])
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return summaries, nil
+}
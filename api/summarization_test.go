@@ -0,0 +1,55 @@
+package api
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Summarization", func() {
+	It("summarizes a few chunks at once", func() {
+		var mu sync.Mutex
+		running, most := 0, 0
+		summarize := func(s string) (string, error) {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return "ok", nil
+		}
+
+		chunks := make([]string, 20)
+		for i := range chunks {
+			chunks[i] = "chunk"
+		}
+		summary, truncated, err := summarizeChunks(chunks, 1000, summarize)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal("ok"))
+		Expect(truncated).To(BeFalse())
+		Expect(most).To(Equal(summarizationWorkers))
+	})
+
+	It("flags the summaries truncated when they don't shrink", func() {
+		var last string
+		summarize := func(s string) (string, error) {
+			last = s
+			return strings.Repeat("x", 10), nil
+		}
+
+		chunks := []string{"a", "b", "c", "d"}
+		summary, truncated, err := summarizeChunks(chunks, 15, summarize)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(summary).To(Equal(strings.Repeat("x", 10)))
+		Expect(truncated).To(BeTrue())
+		Expect(len(last)).To(BeNumerically("<=", 15))
+	})
+})
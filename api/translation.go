@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	model "github.com/go-skynet/LocalAI/pkg/model"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultTranslationPrompt = `Translate the following text from %s to %s. Answer only with the translation.
+
+Text: %s
+
+Translation:`
+
+const defaultLanguageDetectionPrompt = `In which language is the following text written? Answer only with the name of the language.
+
+Text: %s
+
+Language:`
+
+// maximum number of tokens generated to name a language
+const languageDetectionMaxTokens = 8
+
+type TranslationRequest struct {
+	// SourceLanguage is the language of the input. If empty or "auto", it is detected
+	SourceLanguage string `json:"source_language"`
+	TargetLanguage string `json:"target_language"`
+}
+
+type TranslationItem struct {
+	Index          int    `json:"index"`
+	Text           string `json:"text"`
+	SourceLanguage string `json:"source_language"`
+	// Detected is true if the source language was detected
+	Detected bool   `json:"detected"`
+	Object   string `json:"object"`
+}
+
+type TranslationResponse struct {
+	Object         string            `json:"object"`
+	Model          string            `json:"model,omitempty"`
+	TargetLanguage string            `json:"target_language"`
+	Data           []TranslationItem `json:"data"`
+}
+
+func translationEndpoint(cm ConfigMerger, debug bool, loader *model.ModelLoader, threads, ctx int, f16 bool) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		config, input, err := readConfig(cm, c, loader, debug, threads, ctx, f16)
+		if err != nil {
+			return fmt.Errorf("failed reading parameters from request:%w", err)
+		}
+
+		req := new(TranslationRequest)
+		if err := c.BodyParser(req); err != nil {
+			return err
+		}
+
+		if req.TargetLanguage == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "target_language is required")
+		}
+
+		log.Debug().Msgf("Parameter Config: %+v", config)
+
+		// one generation per text, regardless of what was requested
+		single := *input
+		single.N = 1
+
+		predict := func(predInput string, config *Config) (string, error) {
+			choices, err := ComputeChoices(predInput, &single, config, loader, func(s string, c *[]Choice) {
+				*c = append(*c, Choice{Text: s})
+			}, nil)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(choices[0].Text), nil
+		}
+
+		items := []TranslationItem{}
+		for i, text := range config.InputStrings {
+			item := TranslationItem{Index: i, SourceLanguage: req.SourceLanguage, Object: "translation"}
+
+			if item.SourceLanguage == "" || strings.EqualFold(item.SourceLanguage, "auto") {
+				item.SourceLanguage, err = detectLanguage(text, input, config, loader)
+				if err != nil {
+					return err
+				}
+				item.Detected = true
+				log.Debug().Msgf("Detected language: %s", item.SourceLanguage)
+			}
+
+			predInput := fmt.Sprintf(defaultTranslationPrompt, item.SourceLanguage, req.TargetLanguage, text)
+			if config.TemplateConfig.Translation != "" {
+				templatedInput, err := loader.TemplatePrefix(config.TemplateConfig.Translation, struct {
+					Input          string
+					SourceLanguage string
+					TargetLanguage string
+				}{Input: text, SourceLanguage: item.SourceLanguage, TargetLanguage: req.TargetLanguage})
+				if err == nil {
+					predInput = templatedInput
+					log.Debug().Msgf("Template found, input modified to: %s", predInput)
+				}
+			}
+
+			item.Text, err = predict(predInput, config)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+
+		return c.JSON(TranslationResponse{
+			Object:         "list",
+			Model:          input.Model,
+			TargetLanguage: req.TargetLanguage,
+			Data:           items,
+		})
+	}
+}
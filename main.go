@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	api "github.com/go-skynet/LocalAI/api"
 	model "github.com/go-skynet/LocalAI/pkg/model"
@@ -56,6 +57,26 @@ func main() {
 				EnvVars:     []string{"ADDRESS"},
 				Value:       ":8080",
 			},
+			&cli.StringFlag{
+				Name:        "admin-address",
+				DefaultText: "Bind address for the management endpoints. If empty, they are served on the API address.",
+				EnvVars:     []string{"ADMIN_ADDRESS"},
+			},
+			&cli.BoolFlag{
+				Name:        "unprotected-admin",
+				DefaultText: "Serve the management endpoints on the API address without API keys. They are disabled otherwise unless --admin-address or --api-keys-file is set",
+				EnvVars:     []string{"UNPROTECTED_ADMIN"},
+			},
+			&cli.StringSliceFlag{
+				Name:        "allowed-ips",
+				DefaultText: "IPs or CIDR ranges allowed to use the API, comma separated. All are allowed if empty",
+				EnvVars:     []string{"ALLOWED_IPS"},
+			},
+			&cli.StringSliceFlag{
+				Name:        "denied-ips",
+				DefaultText: "IPs or CIDR ranges rejected by the API, comma separated",
+				EnvVars:     []string{"DENIED_IPS"},
+			},
 			&cli.IntFlag{
 				Name:        "context-size",
 				DefaultText: "Default context size of the model",
@@ -68,6 +89,106 @@ func main() {
 				EnvVars:     []string{"UPLOAD_LIMIT"},
 				Value:       15,
 			},
+			&cli.BoolFlag{
+				Name:        "low-memory",
+				DefaultText: "Low memory mode for small devices: keeps a single model in memory, halves the context memory and evaluates the prompts in small batches",
+				EnvVars:     []string{"LOW_MEMORY"},
+			},
+			&cli.BoolFlag{
+				Name:        "refuse-swap",
+				DefaultText: "Refuse to load the models bigger than the available memory, instead of swapping",
+				EnvVars:     []string{"REFUSE_SWAP"},
+			},
+			&cli.BoolFlag{
+				Name:        "require-license-ack",
+				DefaultText: "Refuse to serve the models with a non-commercial license, unless license_acknowledged is set in their config",
+				EnvVars:     []string{"REQUIRE_LICENSE_ACK"},
+			},
+			&cli.StringFlag{
+				Name:        "schedule-file",
+				DefaultText: "YAML file with the scheduled model loads, unloads and downloads",
+				EnvVars:     []string{"SCHEDULE_FILE"},
+			},
+			&cli.StringFlag{
+				Name:        "integrity-check-schedule",
+				DefaultText: "Cron expression (e.g. \"0 3 * * *\") of the checks of the model files checksums, and of the updates at their source url",
+				EnvVars:     []string{"INTEGRITY_CHECK_SCHEDULE"},
+			},
+			&cli.BoolFlag{
+				Name:        "auto-update",
+				DefaultText: "Download the models updated at their source url during the integrity checks",
+				EnvVars:     []string{"AUTO_UPDATE"},
+			},
+			&cli.StringFlag{
+				Name:        "api-keys-file",
+				DefaultText: "YAML file with the API keys accepted, and the models and parameters allowed for each. If set, requests without a valid key are rejected",
+				EnvVars:     []string{"API_KEYS_FILE"},
+			},
+			&cli.StringFlag{
+				Name:        "mqtt-broker",
+				DefaultText: "Address of a MQTT broker (e.g. tcp://localhost:1883) or of a NATS server (e.g. nats://localhost:4222) to serve the API requests published on --mqtt-topic",
+				EnvVars:     []string{"MQTT_BROKER"},
+			},
+			&cli.StringFlag{
+				Name:        "mqtt-topic",
+				DefaultText: "MQTT topic of the requests",
+				EnvVars:     []string{"MQTT_TOPIC"},
+				Value:       "localai/requests",
+			},
+			&cli.StringFlag{
+				Name:        "mqtt-response-topic",
+				DefaultText: "MQTT topic of the responses, unless set by the request",
+				EnvVars:     []string{"MQTT_RESPONSE_TOPIC"},
+				Value:       "localai/responses",
+			},
+			&cli.StringFlag{
+				Name:        "mqtt-client-id",
+				DefaultText: "MQTT client ID",
+				EnvVars:     []string{"MQTT_CLIENT_ID"},
+				Value:       "localai",
+			},
+			&cli.StringFlag{
+				Name:        "mqtt-username",
+				DefaultText: "MQTT username",
+				EnvVars:     []string{"MQTT_USERNAME"},
+			},
+			&cli.StringFlag{
+				Name:        "mqtt-password",
+				DefaultText: "MQTT password",
+				EnvVars:     []string{"MQTT_PASSWORD"},
+			},
+			&cli.IntFlag{
+				Name:        "bridge-workers",
+				DefaultText: "Number of the MQTT or NATS requests served at once",
+				EnvVars:     []string{"BRIDGE_WORKERS"},
+				Value:       4,
+			},
+			&cli.BoolFlag{
+				Name:        "chaos",
+				DefaultText: "Enable the fault injection mode, to test the resilience of the clients. Do not use in production.",
+				EnvVars:     []string{"CHAOS"},
+			},
+			&cli.DurationFlag{
+				Name:        "chaos-latency",
+				DefaultText: "Maximum random latency added to each request in chaos mode",
+				EnvVars:     []string{"CHAOS_LATENCY"},
+			},
+			&cli.Float64Flag{
+				Name:        "chaos-error-rate",
+				DefaultText: "Probability (0-1) of a request failing in chaos mode",
+				EnvVars:     []string{"CHAOS_ERROR_RATE"},
+			},
+			&cli.Float64Flag{
+				Name:        "chaos-disconnect-rate",
+				DefaultText: "Probability (0-1) of a streamed response being cut in chaos mode",
+				EnvVars:     []string{"CHAOS_DISCONNECT_RATE"},
+			},
+			&cli.DurationFlag{
+				Name:        "chaos-disconnect-after",
+				DefaultText: "Maximum time before a streamed response is cut in chaos mode",
+				EnvVars:     []string{"CHAOS_DISCONNECT_AFTER"},
+				Value:       2 * time.Second,
+			},
 		},
 		Description: `
 LocalAI is a drop-in replacement OpenAI API which runs inference locally.
@@ -87,7 +208,64 @@ It uses llama.cpp, ggml and gpt4all as backend with golang c bindings.
 		Copyright: "go-skynet authors",
 		Action: func(ctx *cli.Context) error {
 			fmt.Printf("Starting LocalAI using %d threads, with models path: %s\n", ctx.Int("threads"), ctx.String("models-path"))
-			return api.App(ctx.String("config-file"), model.NewModelLoader(ctx.String("models-path")), ctx.Int("upload-limit"), ctx.Int("threads"), ctx.Int("context-size"), ctx.Bool("f16"), ctx.Bool("debug"), false).Listen(ctx.String("address"))
+
+			var chaos *api.ChaosConfig
+			if ctx.Bool("chaos") {
+				chaos = &api.ChaosConfig{
+					Latency:         ctx.Duration("chaos-latency"),
+					ErrorRate:       ctx.Float64("chaos-error-rate"),
+					DisconnectRate:  ctx.Float64("chaos-disconnect-rate"),
+					DisconnectAfter: ctx.Duration("chaos-disconnect-after"),
+				}
+			}
+
+			access := &api.AccessConfig{
+				AllowedIPs:       ctx.StringSlice("allowed-ips"),
+				DeniedIPs:        ctx.StringSlice("denied-ips"),
+				AdminAddress:     ctx.String("admin-address"),
+				UnprotectedAdmin: ctx.Bool("unprotected-admin"),
+			}
+
+			var bridge *api.BridgeConfig
+			if ctx.String("mqtt-broker") != "" {
+				bridge = &api.BridgeConfig{
+					Broker:        ctx.String("mqtt-broker"),
+					Topic:         ctx.String("mqtt-topic"),
+					ResponseTopic: ctx.String("mqtt-response-topic"),
+					ClientID:      ctx.String("mqtt-client-id"),
+					Username:      ctx.String("mqtt-username"),
+					Password:      ctx.String("mqtt-password"),
+					Workers:       ctx.Int("bridge-workers"),
+				}
+			}
+
+			loader := model.NewModelLoader(ctx.String("models-path"))
+			loader.LowMemory = ctx.Bool("low-memory")
+			loader.RefuseSwap = ctx.Bool("refuse-swap")
+			loader.RequireLicenseAck = ctx.Bool("require-license-ack")
+
+			app, err := api.New(
+				api.WithModelLoader(loader),
+				api.WithConfigFile(ctx.String("config-file")),
+				api.WithUploadLimitMB(ctx.Int("upload-limit")),
+				api.WithThreads(ctx.Int("threads")),
+				api.WithContextSize(ctx.Int("context-size")),
+				api.WithF16(ctx.Bool("f16")),
+				api.WithDebug(ctx.Bool("debug")),
+				api.WithChaos(chaos),
+				api.WithAccess(access),
+				api.WithScheduleFile(ctx.String("schedule-file")),
+				api.WithAPIKeysFile(ctx.String("api-keys-file")),
+				api.WithBridge(bridge),
+				api.WithIntegrityCheck(api.IntegrityConfig{
+					Schedule:   ctx.String("integrity-check-schedule"),
+					AutoUpdate: ctx.Bool("auto-update"),
+				}),
+			)
+			if err != nil {
+				return err
+			}
+			return app.Listen(ctx.String("address"))
 		},
 	}
 
@@ -0,0 +1,194 @@
+// Package client is a Go client for the LocalAI API, covering the OpenAI
+// compatible endpoints and the LocalAI extensions.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client calls a LocalAI server. It is safe for concurrent use.
+type Client struct {
+	baseURL  string
+	adminURL string
+	apiKey   string
+	http     *http.Client
+	retries  int
+	backoff  time.Duration
+}
+
+type Option func(*Client)
+
+// WithAPIKey sends the key as bearer token, for servers started with API keys
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithRetries retries the requests failing with a network error or while the
+// server is unavailable, waiting backoff before the first retry and doubling
+// it at each one.
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = attempts
+		c.backoff = backoff
+	}
+}
+
+// WithAdminURL sets the address of the management endpoints, for servers
+// serving them on a separate address
+func WithAdminURL(url string) Option {
+	return func(c *Client) {
+		c.adminURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// New returns a client for the server at baseURL, e.g. "http://localhost:8080"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    http.DefaultClient,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.adminURL == "" {
+		c.adminURL = c.baseURL
+	}
+	return c
+}
+
+// APIError is an error returned by the server
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("localai: %d %s", e.Code, e.Message)
+}
+
+// retryable returns true for the errors worth retrying the request for
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// send sends the request, retrying it if configured, and returns the
+// response if successful. The caller must close its body.
+func (c *Client) send(ctx context.Context, method, url string, body []byte, contentType string, header http.Header) (*http.Response, error) {
+	backoff := c.backoff
+
+	for i := 0; ; i++ {
+		resp, err := c.sendOnce(ctx, method, url, body, contentType, header)
+		if err == nil || i >= c.retries || !retryable(err) {
+			return resp, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, method, url string, body []byte, contentType string, header http.Header) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func readError(resp *http.Response) error {
+	e := struct {
+		Error *APIError `json:"error"`
+	}{}
+	b, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(b, &e); err != nil || e.Error == nil {
+		return &APIError{Code: resp.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+	if e.Error.Code == 0 {
+		e.Error.Code = resp.StatusCode
+	}
+	return e.Error
+}
+
+// do sends the request as JSON, and decodes the JSON response into out, if not nil
+func (c *Client) do(ctx context.Context, method, url string, in, out interface{}) error {
+	var body []byte
+	contentType := ""
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		contentType = "application/json"
+	}
+
+	resp, err := c.send(ctx, method, url, body, contentType, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) url(path string) string {
+	return c.baseURL + path
+}
+
+func (c *Client) admin(path string) string {
+	return c.adminURL + path
+}
@@ -0,0 +1,104 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/go-skynet/LocalAI/pkg/client"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var server *httptest.Server
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("sends the requests with the API key", func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/v1/completions"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer secret"))
+
+			req := map[string]interface{}{}
+			Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+			Expect(req).To(Equal(map[string]interface{}{"model": "testmodel", "prompt": "foo", "max_time": 1.5}))
+
+			fmt.Fprint(w, `{"object": "text_completion", "choices": [{"text": "bar", "finish_reason": "timeout"}]}`)
+		}))
+
+		c := New(server.URL, WithAPIKey("secret"))
+		resp, err := c.Completion(context.TODO(), Request{Model: "testmodel", Prompt: "foo", MaxTime: 1.5})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Choices).To(HaveLen(1))
+		Expect(resp.Choices[0].Text).To(Equal("bar"))
+		Expect(resp.Choices[0].FinishReason).To(Equal("timeout"))
+	})
+
+	It("returns the API errors", func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"error": {"code": 403, "message": "access denied"}}`)
+		}))
+
+		_, err := New(server.URL).Models(context.TODO())
+		Expect(err).To(Equal(&APIError{Code: 403, Message: "access denied"}))
+	})
+
+	It("retries while the server is unavailable", func() {
+		calls := 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"object": "list", "data": [{"id": "testmodel", "object": "model"}]}`)
+		}))
+
+		models, err := New(server.URL, WithRetries(2, time.Millisecond)).Models(context.TODO())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(models).To(Equal([]Model{{ID: "testmodel", Object: "model"}}))
+		Expect(calls).To(Equal(3))
+	})
+
+	It("resumes the dropped streams", func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/chat/completions":
+				w.Header().Set("X-LocalAI-Stream-ID", "abc")
+				fmt.Fprint(w, "event: data\n\nid: 0\ndata: {\"choices\": [{\"delta\": {\"content\": \"foo\"}}]}\n\n")
+				w.(http.Flusher).Flush()
+				// drop the connection in the middle of the stream
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+			case "/v1/streams/abc":
+				defer GinkgoRecover()
+				Expect(r.Header.Get("Last-Event-ID")).To(Equal("0"))
+				fmt.Fprint(w, "event: data\n\nid: 1\ndata: {\"choices\": [{\"delta\": {\"content\": \"bar\"}}]}\n\n")
+			}
+		}))
+
+		stream, err := New(server.URL).ChatStream(context.TODO(), StreamRequest{Request: Request{Model: "testmodel"}, Resumable: true})
+		Expect(err).ToNot(HaveOccurred())
+		defer stream.Close()
+		Expect(stream.ID()).To(Equal("abc"))
+
+		content := ""
+		for {
+			resp, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).ToNot(HaveOccurred())
+			content += resp.Choices[0].Delta.Content
+		}
+		Expect(content).To(Equal("foobar"))
+	})
+})
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Similarity compares Query to the texts of Input and to Vectors
+func (c *Client) Similarity(ctx context.Context, req SimilarityRequest) (*SimilarityResponse, error) {
+	resp := &SimilarityResponse{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/similarity"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Classify assigns one of Labels to each text of Input
+func (c *Client) Classify(ctx context.Context, req ClassificationRequest) (*ClassificationResponse, error) {
+	resp := &ClassificationResponse{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/classifications"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Summarize summarizes the texts of Input, of any length
+func (c *Client) Summarize(ctx context.Context, req Request) (*SummarizationResponse, error) {
+	resp := &SummarizationResponse{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/summarize"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Translate translates the texts of Input to TargetLanguage
+func (c *Client) Translate(ctx context.Context, req TranslationRequest) (*TranslationResponse, error) {
+	resp := &TranslationResponse{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/translate"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ExportSession returns a chat session kept server-side
+func (c *Client) ExportSession(ctx context.Context, id string) (*Session, error) {
+	resp := &Session{}
+	if err := c.do(ctx, http.MethodGet, c.url("/v1/sessions/"+url.PathEscape(id)+"/export"), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ImportSession creates a session from an exported one, and returns it with its new ID
+func (c *Client) ImportSession(ctx context.Context, session Session) (*Session, error) {
+	resp := &Session{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/sessions/import"), session, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) DeleteSession(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.url("/v1/sessions/"+url.PathEscape(id)), nil, nil)
+}
+
+// Prompts lists the prompts of the prompt library
+func (c *Client) Prompts(ctx context.Context) ([]Prompt, error) {
+	out := struct {
+		Data []Prompt `json:"data"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, c.admin("/prompts"), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Data, nil
+}
+
+func (c *Client) Prompt(ctx context.Context, name string) (*Prompt, error) {
+	resp := &Prompt{}
+	if err := c.do(ctx, http.MethodGet, c.admin("/prompts/"+url.PathEscape(name)), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SavePrompt creates or replaces a prompt
+func (c *Client) SavePrompt(ctx context.Context, prompt Prompt) error {
+	return c.do(ctx, http.MethodPut, c.admin("/prompts/"+url.PathEscape(prompt.Name)), prompt, nil)
+}
+
+func (c *Client) DeletePrompt(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, c.admin("/prompts/"+url.PathEscape(name)), nil, nil)
+}
+
+// ModelLoadErrors returns the recent failed model loads
+func (c *Client) ModelLoadErrors(ctx context.Context) ([]LoadEvent, error) {
+	out := struct {
+		Errors []LoadEvent `json:"errors"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, c.admin("/models/errors"), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Errors, nil
+}
+
+// Memory returns the memory usage of the server
+func (c *Client) Memory(ctx context.Context) (*MemoryStats, error) {
+	resp := &MemoryStats{}
+	if err := c.do(ctx, http.MethodGet, c.admin("/memory"), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Backends returns the status of the backends of the server
+func (c *Client) Backends(ctx context.Context) ([]BackendStatus, error) {
+	out := struct {
+		Backends []BackendStatus `json:"backends"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, c.admin("/backends"), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Backends, nil
+}
+
+// ModelIntegrity returns the results of the last check of the model files
+func (c *Client) ModelIntegrity(ctx context.Context) (*IntegrityReport, error) {
+	resp := &IntegrityReport{}
+	if err := c.do(ctx, http.MethodGet, c.admin("/models/integrity"), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CheckModelIntegrity starts a check of the model files, whose results are
+// returned by ModelIntegrity once completed
+func (c *Client) CheckModelIntegrity(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, c.admin("/models/integrity"), nil, nil)
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+)
+
+// Completion generates text from Prompt
+func (c *Client) Completion(ctx context.Context, req Request) (*Response, error) {
+	resp := &Response{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/completions"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ChatCompletion generates the reply to Messages
+func (c *Client) ChatCompletion(ctx context.Context, req Request) (*Response, error) {
+	resp := &Response{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/chat/completions"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Edit applies Instruction to Input
+func (c *Client) Edit(ctx context.Context, req Request) (*Response, error) {
+	resp := &Response{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/edits"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Embeddings computes the embeddings of Input
+func (c *Client) Embeddings(ctx context.Context, req Request) (*EmbeddingsResponse, error) {
+	resp := &EmbeddingsResponse{}
+	if err := c.do(ctx, http.MethodPost, c.url("/v1/embeddings"), req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Transcription transcribes the audio read from audio
+func (c *Client) Transcription(ctx context.Context, req TranscriptionRequest, audio io.Reader) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("model", req.Model)
+	if req.Language != "" {
+		w.WriteField("language", req.Language)
+	}
+	f, err := w.CreateFormFile("file", req.FileName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, audio); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, c.url("/v1/audio/transcriptions"), body.Bytes(), w.FormDataContentType(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	out := struct {
+		Text string `json:"text"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	return out.Text, nil
+}
+
+// Models lists the models available
+func (c *Client) Models(ctx context.Context) ([]Model, error) {
+	out := struct {
+		Data []Model `json:"data"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, c.url("/v1/models"), nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Data, nil
+}
+
+// Model returns a model, with its license and description
+func (c *Client) Model(ctx context.Context, id string) (*Model, error) {
+	resp := &Model{}
+	if err := c.do(ctx, http.MethodGet, c.url("/v1/models/"+url.PathEscape(id)), nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
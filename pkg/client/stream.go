@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const streamIDHeader = "X-LocalAI-Stream-ID"
+
+// Stream reads the chunks of a streamed chat completion
+type Stream struct {
+	c      *Client
+	ctx    context.Context
+	id     string
+	body   io.ReadCloser
+	reader *bufio.Reader
+	// lastEvent is the id of the last event received, -1 if none
+	lastEvent int
+}
+
+// ChatStream starts a streamed chat completion. The stream must be closed.
+func (c *Client) ChatStream(ctx context.Context, req StreamRequest) (*Stream, error) {
+	body, err := json.Marshal(struct {
+		StreamRequest
+		Stream bool `json:"stream"`
+	}{StreamRequest: req, Stream: true})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, c.url("/v1/chat/completions"), body, "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	return newStream(c, ctx, resp), nil
+}
+
+// ResumeStream reconnects to a resumable stream, replaying it from the event
+// after lastEvent. Use -1 to replay it from the start.
+func (c *Client) ResumeStream(ctx context.Context, id string, lastEvent int) (*Stream, error) {
+	s := &Stream{c: c, ctx: ctx, id: id, lastEvent: lastEvent}
+	if err := s.resume(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newStream(c *Client, ctx context.Context, resp *http.Response) *Stream {
+	return &Stream{
+		c:         c,
+		ctx:       ctx,
+		id:        resp.Header.Get(streamIDHeader),
+		body:      resp.Body,
+		reader:    bufio.NewReader(resp.Body),
+		lastEvent: -1,
+	}
+}
+
+// ID returns the ID of a resumable stream, empty otherwise
+func (s *Stream) ID() string {
+	return s.id
+}
+
+func (s *Stream) resume() error {
+	if s.body != nil {
+		s.body.Close()
+	}
+
+	header := http.Header{}
+	if s.lastEvent >= 0 {
+		header.Set("Last-Event-ID", strconv.Itoa(s.lastEvent))
+	}
+	resp, err := s.c.send(s.ctx, http.MethodGet, s.c.url("/v1/streams/"+url.PathEscape(s.id)), nil, "", header)
+	if err != nil {
+		return err
+	}
+	s.body = resp.Body
+	s.reader = bufio.NewReader(resp.Body)
+	return nil
+}
+
+// Recv returns the next chunk of the stream, or io.EOF once completed. A
+// resumable stream is resumed if the connection drops.
+func (s *Stream) Recv() (*Response, error) {
+	eventID := -1
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && line == "" {
+				return nil, io.EOF
+			}
+			if s.id == "" || s.ctx.Err() != nil {
+				return nil, err
+			}
+			if err := s.resume(); err != nil {
+				return nil, err
+			}
+			eventID = -1
+			continue
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			if i, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "id:"))); err == nil {
+				eventID = i
+			}
+		case strings.HasPrefix(line, "data:"):
+			resp := &Response{}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), resp); err != nil {
+				return nil, err
+			}
+			if eventID >= 0 {
+				s.lastEvent = eventID
+			}
+			return resp, nil
+		}
+	}
+}
+
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
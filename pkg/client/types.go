@@ -0,0 +1,281 @@
+package client
+
+import "time"
+
+// Request holds the parameters shared by the generation endpoints. The zero
+// values are not sent, and the server defaults apply.
+type Request struct {
+	Model string `json:"model,omitempty"`
+
+	// Prompt is a string or a list of strings, read by completions
+	Prompt interface{} `json:"prompt,omitempty"`
+	// Input is a string or a list of strings, read by edits and embeddings
+	Input       interface{} `json:"input,omitempty"`
+	Instruction string      `json:"instruction,omitempty"`
+	Messages    []Message   `json:"messages,omitempty"`
+	Stop        interface{} `json:"stop,omitempty"`
+
+	TopP        float64 `json:"top_p,omitempty"`
+	TopK        int     `json:"top_k,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	N           int     `json:"n,omitempty"`
+	Echo        bool    `json:"echo,omitempty"`
+
+	Batch         int     `json:"batch,omitempty"`
+	F16           bool    `json:"f16,omitempty"`
+	IgnoreEOS     bool    `json:"ignore_eos,omitempty"`
+	RepeatPenalty float64 `json:"repeat_penalty,omitempty"`
+	Keep          int     `json:"n_keep,omitempty"`
+	MirostatETA   float64 `json:"mirostat_eta,omitempty"`
+	MirostatTAU   float64 `json:"mirostat_tau,omitempty"`
+	Mirostat      int     `json:"mirostat,omitempty"`
+	Seed          int     `json:"seed,omitempty"`
+
+	// MaxTime stops the generation after the given seconds
+	MaxTime float64 `json:"max_time,omitempty"`
+	// ResponseLanguage is the language the answers must be written in
+	ResponseLanguage string `json:"response_language,omitempty"`
+	// SessionID keeps the conversation server-side across chat completions
+	SessionID string `json:"session_id,omitempty"`
+	// PromptRef renders a prompt of the server prompt library
+	PromptRef       string                 `json:"prompt_ref,omitempty"`
+	PromptVariables map[string]interface{} `json:"prompt_variables,omitempty"`
+	// ReturnMetadata attaches the generation metadata to the response
+	ReturnMetadata bool `json:"return_metadata,omitempty"`
+
+	// Embeddings
+	Dimensions int  `json:"dimensions,omitempty"`
+	Normalize  bool `json:"normalize,omitempty"`
+}
+
+// StreamRequest is a streamed chat completion request
+type StreamRequest struct {
+	Request
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// Resumable keeps the generation going server-side if the connection
+	// drops. The stream is resumed transparently by Stream.Recv.
+	Resumable bool `json:"resumable,omitempty"`
+}
+
+type StreamOptions struct {
+	// Granularity is "token", "word" or "interval"
+	Granularity   string `json:"granularity,omitempty"`
+	FlushInterval int    `json:"flush_interval_ms,omitempty"`
+	IncludeUsage  bool   `json:"include_usage,omitempty"`
+}
+
+type Message struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type Choice struct {
+	Index        int      `json:"index,omitempty"`
+	FinishReason string   `json:"finish_reason,omitempty"`
+	Message      *Message `json:"message,omitempty"`
+	Delta        *Message `json:"delta,omitempty"`
+	Text         string   `json:"text,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type GenerationMetadata struct {
+	Model       string  `json:"model"`
+	Backend     string  `json:"backend,omitempty"`
+	Seed        int     `json:"seed"`
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+	TopK        int     `json:"top_k"`
+	MaxTokens   int     `json:"max_tokens"`
+	Created     int64   `json:"created"`
+	ContentHash string  `json:"content_hash"`
+}
+
+// Accounting is the time spent by a request and the size of what it
+// processed, in the last event of a stream
+type Accounting struct {
+	QueueTimeMs     int64  `json:"queue_time_ms"`
+	InferenceTimeMs int64  `json:"inference_time_ms"`
+	GeneratedTokens *int64 `json:"generated_tokens,omitempty"`
+	PromptBytes     int64  `json:"prompt_bytes"`
+	GeneratedBytes  int64  `json:"generated_bytes"`
+}
+
+// Response is returned by completions, chat completions and edits, and is
+// the event of a stream
+type Response struct {
+	Created    int                 `json:"created,omitempty"`
+	Object     string              `json:"object,omitempty"`
+	ID         string              `json:"id,omitempty"`
+	Model      string              `json:"model,omitempty"`
+	Choices    []Choice            `json:"choices,omitempty"`
+	Usage      Usage               `json:"usage"`
+	Metadata   *GenerationMetadata `json:"generation_metadata,omitempty"`
+	Accounting *Accounting         `json:"accounting,omitempty"`
+}
+
+type Embedding struct {
+	Embedding []float32 `json:"embedding"`
+	Index     int       `json:"index"`
+	Object    string    `json:"object,omitempty"`
+}
+
+type EmbeddingsResponse struct {
+	Object string      `json:"object,omitempty"`
+	Model  string      `json:"model,omitempty"`
+	Data   []Embedding `json:"data"`
+}
+
+type Model struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+
+	Description   string `json:"description,omitempty"`
+	License       string `json:"license,omitempty"`
+	URL           string `json:"url,omitempty"`
+	NonCommercial bool   `json:"non_commercial,omitempty"`
+}
+
+type TranscriptionRequest struct {
+	Model    string
+	Language string
+	// FileName is the name of the audio file sent, its extension tells the format
+	FileName string
+}
+
+type SimilarityRequest struct {
+	Request
+	Query   string      `json:"query"`
+	Vectors [][]float32 `json:"vectors,omitempty"`
+}
+
+type SimilarityResponse struct {
+	Object string `json:"object"`
+	Model  string `json:"model,omitempty"`
+	Data   []struct {
+		Index      int     `json:"index"`
+		Similarity float64 `json:"similarity"`
+		Object     string  `json:"object"`
+	} `json:"data"`
+}
+
+type ClassificationRequest struct {
+	Request
+	Labels []string `json:"labels"`
+}
+
+type ClassificationResponse struct {
+	Object string `json:"object"`
+	Model  string `json:"model,omitempty"`
+	Data   []struct {
+		Index  int                `json:"index"`
+		Label  string             `json:"label"`
+		Scores map[string]float64 `json:"scores,omitempty"`
+		Object string             `json:"object"`
+	} `json:"data"`
+}
+
+type SummarizationResponse struct {
+	Object  string `json:"object"`
+	Model   string `json:"model,omitempty"`
+	Summary string `json:"summary"`
+	Chunks  int    `json:"chunks"`
+}
+
+type TranslationRequest struct {
+	Request
+	// SourceLanguage is detected by the model if empty
+	SourceLanguage string `json:"source_language,omitempty"`
+	TargetLanguage string `json:"target_language"`
+}
+
+type TranslationResponse struct {
+	Object         string `json:"object"`
+	Model          string `json:"model,omitempty"`
+	TargetLanguage string `json:"target_language"`
+	Data           []struct {
+		Index          int    `json:"index"`
+		Text           string `json:"text"`
+		SourceLanguage string `json:"source_language"`
+		Detected       bool   `json:"detected"`
+		Object         string `json:"object"`
+	} `json:"data"`
+}
+
+type SessionParameters struct {
+	Temperature float64 `json:"temperature"`
+	TopP        float64 `json:"top_p"`
+	TopK        int     `json:"top_k"`
+	MaxTokens   int     `json:"max_tokens"`
+	Seed        int     `json:"seed"`
+}
+
+type Session struct {
+	ID         string            `json:"id"`
+	Model      string            `json:"model"`
+	Messages   []Message         `json:"messages"`
+	Parameters SessionParameters `json:"parameters"`
+	Created    int64             `json:"created"`
+	Updated    int64             `json:"updated"`
+}
+
+type Prompt struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+}
+
+type LoadEvent struct {
+	Model       string        `json:"model"`
+	Backend     string        `json:"backend,omitempty"`
+	Time        time.Time     `json:"time"`
+	Duration    time.Duration `json:"duration_ns"`
+	Success     bool          `json:"success"`
+	Error       string        `json:"error,omitempty"`
+	MemoryDelta int64         `json:"memory_delta"`
+	LoadMode    string        `json:"load_mode,omitempty"`
+}
+
+type MemoryStats struct {
+	Total        int64    `json:"total"`
+	Available    int64    `json:"available"`
+	SwapTotal    int64    `json:"swap_total"`
+	SwapFree     int64    `json:"swap_free"`
+	Resident     int64    `json:"resident"`
+	Pressure10   float64  `json:"pressure_avg10"`
+	Pressure60   float64  `json:"pressure_avg60"`
+	LoadedModels []string `json:"loaded_models"`
+}
+
+type BackendStatus struct {
+	Name string `json:"name"`
+	// Status is "available", "failing", "unavailable" or "unknown"
+	Status  string     `json:"status"`
+	Reason  string     `json:"reason,omitempty"`
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+type ModelCheck struct {
+	Model string    `json:"model"`
+	File  string    `json:"file"`
+	Time  time.Time `json:"time"`
+	// Status is "ok", "unverified", "corrupted", "incomplete", "missing" or "error"
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	SHA256          string    `json:"sha256,omitempty"`
+	Size            int64     `json:"size"`
+	ModTime         time.Time `json:"mod_time"`
+	Source          string    `json:"source,omitempty"`
+	UpdateAvailable bool      `json:"update_available"`
+	Updated         bool      `json:"updated"`
+}
+
+type IntegrityReport struct {
+	// LastRun is nil until a check completed
+	LastRun *time.Time   `json:"last_run,omitempty"`
+	Models  []ModelCheck `json:"models"`
+}
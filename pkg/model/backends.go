@@ -0,0 +1,136 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// BackendAvailable backends loaded a model successfully
+	BackendAvailable = "available"
+	// BackendFailing backends were tried, but did not load any model yet.
+	// The models might just be in another format.
+	BackendFailing = "failing"
+	// BackendUnavailable backends crashed while loading, and are not used
+	// until BackendRetryInterval passed, or they are reset
+	BackendUnavailable = "unavailable"
+	// BackendUnknown backends were not tried yet
+	BackendUnknown = "unknown"
+)
+
+// BackendRetryInterval is how long a backend that crashed is not used
+var BackendRetryInterval = 10 * time.Minute
+
+// BackendStatus reports whether a backend can load models
+type BackendStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Reason is the last error of a failing or unavailable backend
+	Reason string `json:"reason,omitempty"`
+	// RetryAt is when an unavailable backend is used again
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// backendCrash is the last crash of an unavailable backend
+type backendCrash struct {
+	reason  string
+	retryAt time.Time
+}
+
+// BackendsStatus returns the status of all the backends, from the recent
+// load attempts
+func (ml *ModelLoader) BackendsStatus() []BackendStatus {
+	status := map[string]*BackendStatus{}
+	for _, e := range ml.LoadEvents() {
+		s, ok := status[e.Backend]
+		if !ok {
+			s = &BackendStatus{Name: e.Backend, Status: BackendFailing}
+			status[e.Backend] = s
+		}
+		if e.Success {
+			s.Status, s.Reason = BackendAvailable, ""
+		} else if s.Status == BackendFailing {
+			s.Reason = e.Error
+		}
+	}
+
+	ml.backendsMu.Lock()
+	defer ml.backendsMu.Unlock()
+
+	res := []BackendStatus{}
+	for _, b := range backends {
+		s := BackendStatus{Name: b, Status: BackendUnknown}
+		if st, ok := status[b]; ok {
+			s = *st
+		}
+		if crash, ok := ml.unavailable[b]; ok {
+			retryAt := crash.retryAt
+			s.Status, s.Reason, s.RetryAt = BackendUnavailable, crash.reason, &retryAt
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+// disableBackend stops using a backend that crashed for BackendRetryInterval
+func (ml *ModelLoader) disableBackend(backend, reason string) {
+	log.Error().Str("backend", backend).Str("reason", reason).Msg("Backend unavailable")
+
+	ml.backendsMu.Lock()
+	defer ml.backendsMu.Unlock()
+	if ml.unavailable == nil {
+		ml.unavailable = map[string]backendCrash{}
+	}
+	ml.unavailable[backend] = backendCrash{reason: reason, retryAt: time.Now().Add(BackendRetryInterval)}
+}
+
+// backendUnavailable returns an error while the backend is disabled. Once
+// the retry interval passed, the next load tries it again.
+func (ml *ModelLoader) backendUnavailable(backend string) error {
+	ml.backendsMu.Lock()
+	defer ml.backendsMu.Unlock()
+	crash, ok := ml.unavailable[backend]
+	if !ok {
+		return nil
+	}
+	if time.Now().Before(crash.retryAt) {
+		return fmt.Errorf("backend %s is unavailable until %s: %s", backend, crash.retryAt.Format(time.RFC3339), crash.reason)
+	}
+	delete(ml.unavailable, backend)
+	return nil
+}
+
+// ResetBackend uses again a backend that crashed, without waiting for the
+// retry interval. It returns an error if the backend is unknown.
+func (ml *ModelLoader) ResetBackend(backend string) error {
+	backend = strings.ToLower(backend)
+	known := false
+	for _, b := range backends {
+		known = known || b == backend
+	}
+	if !known {
+		return fmt.Errorf("backend %s is unknown", backend)
+	}
+
+	ml.backendsMu.Lock()
+	defer ml.backendsMu.Unlock()
+	delete(ml.unavailable, backend)
+	return nil
+}
+
+// safeLoad recovers the panics of the backends, for a broken backend not to
+// take down the whole process. Only the Go panics are recovered: the crashes
+// of the native code (e.g. a segmentation fault) still stop the process, and
+// a missing shared library stops it before it starts.
+func safeLoad(loader func(string) (interface{}, error), modelFile string) (model interface{}, panicked bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked, err = true, fmt.Errorf("backend crashed: %v", r)
+		}
+	}()
+	model, err = loader(modelFile)
+	return model, false, err
+}
@@ -0,0 +1,72 @@
+package model_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/go-skynet/LocalAI/pkg/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backends status", func() {
+	var loader *ModelLoader
+	crashing := func(string) (interface{}, error) { panic("missing symbol") }
+	status := func(backend string) BackendStatus {
+		for _, s := range loader.BackendsStatus() {
+			if s.Name == backend {
+				return s
+			}
+		}
+		Fail("unknown backend " + backend)
+		return BackendStatus{}
+	}
+	BeforeEach(func() {
+		loader = NewModelLoader(GinkgoT().TempDir())
+	})
+
+	It("reports the backends tried and failing", func() {
+		Expect(status(LlamaBackend).Status).To(Equal(BackendUnknown))
+		_, err := loader.LoadModel(LlamaBackend, "model.bin", func(string) (interface{}, error) {
+			return nil, errors.New("invalid model file")
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(status(LlamaBackend)).To(Equal(BackendStatus{Name: LlamaBackend, Status: BackendFailing, Reason: "invalid model file"}))
+	})
+	It("disables the backends crashing until they are reset", func() {
+		_, err := loader.LoadModel(LlamaBackend, "model.bin", crashing)
+		Expect(err).To(MatchError(ContainSubstring("backend crashed: missing symbol")))
+		Expect(status(LlamaBackend).Status).To(Equal(BackendUnavailable))
+		Expect(status(LlamaBackend).RetryAt).ToNot(BeNil())
+
+		_, err = loader.LoadModel(LlamaBackend, "model.bin", func(string) (interface{}, error) { return &fakeModel{}, nil })
+		Expect(err).To(MatchError(ContainSubstring("backend llama is unavailable")))
+
+		Expect(loader.ResetBackend("LLaMA")).To(Succeed())
+		_, err = loader.LoadModel(LlamaBackend, "model.bin", func(string) (interface{}, error) { return &fakeModel{}, nil })
+		Expect(err).ToNot(HaveOccurred())
+		Expect(status(LlamaBackend).Status).To(Equal(BackendAvailable))
+
+		Expect(loader.ResetBackend("foo")).To(HaveOccurred())
+	})
+	It("tries the backends again after the retry interval", func() {
+		interval := BackendRetryInterval
+		BackendRetryInterval = 50 * time.Millisecond
+		DeferCleanup(func() { BackendRetryInterval = interval })
+
+		_, err := loader.LoadModel(LlamaBackend, "model.bin", crashing)
+		Expect(err).To(HaveOccurred())
+		Eventually(func() error {
+			_, err := loader.LoadModel(LlamaBackend, "model.bin", func(string) (interface{}, error) { return &fakeModel{}, nil })
+			return err
+		}).Should(Succeed())
+	})
+	It("reports the backends by their lowercase name", func() {
+		_, err := loader.BackendLoader("LLAMA", "model.bin", nil, 1)
+		Expect(err).To(HaveOccurred())
+		Expect(status(LlamaBackend).Status).To(Equal(BackendFailing))
+		for _, s := range loader.BackendsStatus() {
+			Expect(s.Name).ToNot(Equal("LLAMA"))
+		}
+	})
+})
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maximum number of load events kept in memory
+const maxLoadEvents = 100
+
+const (
+	// LoadModeMmap models are mapped from their file, and paged in on demand
+	LoadModeMmap = "mmap"
+	// LoadModeFull models are read whole in memory
+	LoadModeFull = "full"
+)
+
+// LoadEvent records a model load attempt
+type LoadEvent struct {
+	Model    string        `json:"model"`
+	Backend  string        `json:"backend,omitempty"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Success  bool          `json:"success"`
+	Error    string        `json:"error,omitempty"`
+	// MemoryDelta is the change of the process resident memory (in bytes) across the load
+	MemoryDelta int64 `json:"memory_delta"`
+	// LoadMode tells whether the model file was mapped ("mmap") or read
+	// whole in memory ("full"), for the successful loads where /proc is
+	// available
+	LoadMode string `json:"load_mode,omitempty"`
+}
+
+// LoadStats sums the load attempts of a model with a backend, since the start
+type LoadStats struct {
+	Model    string
+	Backend  string
+	Success  bool
+	Count    int
+	Duration time.Duration
+	// LoadMode and MemoryDelta are the ones of the last attempt
+	LoadMode    string
+	MemoryDelta int64
+}
+
+type loadStatsKey struct {
+	model, backend string
+	success        bool
+}
+
+func (ml *ModelLoader) recordLoad(e LoadEvent) {
+	l := log.Info()
+	if !e.Success {
+		l = log.Warn().Str("error", e.Error)
+	}
+	l.Str("model", e.Model).
+		Str("backend", e.Backend).
+		Dur("duration", e.Duration).
+		Int64("memory_delta", e.MemoryDelta).
+		Str("load_mode", e.LoadMode).
+		Bool("success", e.Success).
+		Msg("Model load")
+
+	ml.eventsMu.Lock()
+	defer ml.eventsMu.Unlock()
+	ml.events = append(ml.events, e)
+	if len(ml.events) > maxLoadEvents {
+		ml.events = ml.events[len(ml.events)-maxLoadEvents:]
+	}
+
+	if ml.loadStats == nil {
+		ml.loadStats = map[loadStatsKey]*LoadStats{}
+	}
+	key := loadStatsKey{model: e.Model, backend: e.Backend, success: e.Success}
+	stats, ok := ml.loadStats[key]
+	if !ok {
+		stats = &LoadStats{Model: e.Model, Backend: e.Backend, Success: e.Success}
+		ml.loadStats[key] = stats
+	}
+	stats.Count++
+	stats.Duration += e.Duration
+	stats.LoadMode, stats.MemoryDelta = e.LoadMode, e.MemoryDelta
+}
+
+// LoadStats returns the load attempts summed by model, backend and outcome
+func (ml *ModelLoader) LoadStats() []LoadStats {
+	ml.eventsMu.Lock()
+	defer ml.eventsMu.Unlock()
+
+	stats := []LoadStats{}
+	for _, s := range ml.loadStats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Model != stats[j].Model {
+			return stats[i].Model < stats[j].Model
+		}
+		if stats[i].Backend != stats[j].Backend {
+			return stats[i].Backend < stats[j].Backend
+		}
+		return stats[i].Success && !stats[j].Success
+	})
+	return stats
+}
+
+// LoadEvents returns the most recent model load attempts, oldest first
+func (ml *ModelLoader) LoadEvents() []LoadEvent {
+	ml.eventsMu.Lock()
+	defer ml.eventsMu.Unlock()
+	return append([]LoadEvent{}, ml.events...)
+}
+
+// LoadErrors returns the most recent failed model load attempts, oldest first
+func (ml *ModelLoader) LoadErrors() []LoadEvent {
+	errs := []LoadEvent{}
+	for _, e := range ml.LoadEvents() {
+		if !e.Success {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+// residentMemory returns the resident set size of the process in bytes. The
+// Go runtime stats are not enough here, as the backends allocate in C.
+// It returns 0 where /proc is not available.
+func residentMemory() int64 {
+	dat, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(dat))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+// loadMode tells whether the model file is mapped in the memory of the
+// process, from /proc/self/maps. It returns an empty mode where /proc is not
+// available.
+func loadMode(modelFile string) string {
+	dat, err := os.ReadFile("/proc/self/maps")
+	if err != nil {
+		return ""
+	}
+	// the mappings list the resolved paths
+	path, err := filepath.Abs(modelFile)
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	// 7f2c4a000000-7f2c8a000000 r--s 00000000 fd:01 1234  /models/model.bin
+	for _, line := range strings.Split(string(dat), "\n") {
+		if strings.HasSuffix(line, " "+path) {
+			return LoadModeMmap
+		}
+	}
+	return LoadModeFull
+}
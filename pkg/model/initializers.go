@@ -116,37 +116,39 @@ func rwkvLM(tokenFile string, threads uint32) func(string) (interface{}, error)
 }
 
 func (ml *ModelLoader) BackendLoader(backendString string, modelFile string, llamaOpts []llama.ModelOption, threads uint32) (model interface{}, err error) {
-	switch strings.ToLower(backendString) {
+	// the backends are reported by their lowercase name
+	backendString = strings.ToLower(backendString)
+	switch backendString {
 	case LlamaBackend:
-		return ml.LoadModel(modelFile, llamaLM(llamaOpts...))
+		return ml.loadModel(backendString, modelFile, llamaContextMemory(llamaOpts), llamaLM(llamaOpts...))
 	case BloomzBackend:
-		return ml.LoadModel(modelFile, bloomzLM)
+		return ml.LoadModel(backendString, modelFile, bloomzLM)
 	case StableLMBackend:
-		return ml.LoadModel(modelFile, stableLM)
+		return ml.LoadModel(backendString, modelFile, stableLM)
 	case DollyBackend:
-		return ml.LoadModel(modelFile, dolly)
+		return ml.LoadModel(backendString, modelFile, dolly)
 	case RedPajamaBackend:
-		return ml.LoadModel(modelFile, redPajama)
+		return ml.LoadModel(backendString, modelFile, redPajama)
 	case Gpt2Backend:
-		return ml.LoadModel(modelFile, gpt2LM)
+		return ml.LoadModel(backendString, modelFile, gpt2LM)
 	case GPTNeoXBackend:
-		return ml.LoadModel(modelFile, gptNeoX)
+		return ml.LoadModel(backendString, modelFile, gptNeoX)
 	case ReplitBackend:
-		return ml.LoadModel(modelFile, replit)
+		return ml.LoadModel(backendString, modelFile, replit)
 	case StarcoderBackend:
-		return ml.LoadModel(modelFile, starCoder)
+		return ml.LoadModel(backendString, modelFile, starCoder)
 	case Gpt4AllLlamaBackend:
-		return ml.LoadModel(modelFile, gpt4allLM(gpt4all.SetThreads(int(threads)), gpt4all.SetModelType(gpt4all.LLaMAType)))
+		return ml.LoadModel(backendString, modelFile, gpt4allLM(gpt4all.SetThreads(int(threads)), gpt4all.SetModelType(gpt4all.LLaMAType)))
 	case Gpt4AllMptBackend:
-		return ml.LoadModel(modelFile, gpt4allLM(gpt4all.SetThreads(int(threads)), gpt4all.SetModelType(gpt4all.MPTType)))
+		return ml.LoadModel(backendString, modelFile, gpt4allLM(gpt4all.SetThreads(int(threads)), gpt4all.SetModelType(gpt4all.MPTType)))
 	case Gpt4AllJBackend:
-		return ml.LoadModel(modelFile, gpt4allLM(gpt4all.SetThreads(int(threads)), gpt4all.SetModelType(gpt4all.GPTJType)))
+		return ml.LoadModel(backendString, modelFile, gpt4allLM(gpt4all.SetThreads(int(threads)), gpt4all.SetModelType(gpt4all.GPTJType)))
 	case BertEmbeddingsBackend:
-		return ml.LoadModel(modelFile, bertEmbeddings)
+		return ml.LoadModel(backendString, modelFile, bertEmbeddings)
 	case RwkvBackend:
-		return ml.LoadModel(modelFile, rwkvLM(filepath.Join(ml.ModelPath, modelFile+tokenizerSuffix), threads))
+		return ml.LoadModel(backendString, modelFile, rwkvLM(filepath.Join(ml.ModelPath, modelFile+tokenizerSuffix), threads))
 	case WhisperBackend:
-		return ml.LoadModel(modelFile, whisperModel)
+		return ml.LoadModel(backendString, modelFile, whisperModel)
 	default:
 		return nil, fmt.Errorf("backend unsupported: %s", backendString)
 	}
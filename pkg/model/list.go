@@ -0,0 +1,152 @@
+package model
+
+import (
+	"os"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// ModelsListTTL is how long the cached models list is served before checking
+// the models path for changes, when the models path can't be watched
+const ModelsListTTL = 2 * time.Second
+
+type modelsList struct {
+	models []string
+	// stale is set by the changes of the models path, the list is refreshed
+	// by the next call
+	stale    bool
+	watching bool
+	// watcher watches the models path, closed by Close
+	watcher *fsnotify.Watcher
+	// modTime is the modification time of the models path when listed, used
+	// to poll it if it isn't watched
+	modTime    time.Time
+	checked    time.Time
+	refreshing bool
+}
+
+// CachedListModels returns the models in the models path, like ListModels,
+// without listing the directory on every call. The models path is watched,
+// and listed again after it changed. If it can't be watched, the list older
+// than ModelsListTTL is still returned, and refreshed in the background if
+// the models path changed since.
+func (ml *ModelLoader) CachedListModels() ([]string, error) {
+	ml.listMu.Lock()
+	defer ml.listMu.Unlock()
+
+	if ml.list.checked.IsZero() {
+		ml.list.watching = ml.watchList()
+		return ml.refreshList()
+	}
+
+	if ml.list.watching {
+		if ml.list.stale {
+			return ml.refreshList()
+		}
+		return ml.list.models, nil
+	}
+
+	if time.Since(ml.list.checked) > ModelsListTTL && !ml.list.refreshing {
+		ml.list.refreshing = true
+		go func() {
+			ml.listMu.Lock()
+			defer ml.listMu.Unlock()
+			ml.list.refreshing = false
+			if _, err := ml.refreshList(); err != nil {
+				log.Debug().Msgf("failed refreshing the models list: %s", err.Error())
+			}
+		}()
+	}
+
+	return ml.list.models, nil
+}
+
+// watchList marks the list stale on the changes of the models path, until
+// the models path is removed. ml.listMu must be held
+func (ml *ModelLoader) watchList() bool {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warn().Msgf("can't watch the models path, polling it: %s", err.Error())
+		return false
+	}
+	if err := watcher.Add(ml.ModelPath); err != nil {
+		watcher.Close()
+		log.Warn().Msgf("can't watch the models path, polling it: %s", err.Error())
+		return false
+	}
+
+	ml.list.watcher = watcher
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				ml.listMu.Lock()
+				ml.list.stale = true
+				// without the models path there's nothing left to watch:
+				// poll it, in case it is created again
+				if event.Name == ml.ModelPath && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					ml.list.watching = false
+					ml.list.watcher = nil
+					ml.listMu.Unlock()
+					return
+				}
+				ml.listMu.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// events might have been lost
+				log.Debug().Msgf("watching the models path: %s", err.Error())
+				ml.listMu.Lock()
+				ml.list.stale = true
+				ml.listMu.Unlock()
+			}
+		}
+	}()
+	return true
+}
+
+// Close stops watching the models path: the models list is polled from then
+// on
+func (ml *ModelLoader) Close() error {
+	ml.listMu.Lock()
+	defer ml.listMu.Unlock()
+	if ml.list.watcher == nil {
+		return nil
+	}
+	err := ml.list.watcher.Close()
+	ml.list.watcher = nil
+	ml.list.watching = false
+	return err
+}
+
+// refreshList lists the models path again if it was modified since the last
+// listing. ml.listMu must be held
+func (ml *ModelLoader) refreshList() ([]string, error) {
+	info, err := os.Stat(ml.ModelPath)
+	if err != nil {
+		return []string{}, err
+	}
+
+	if ml.list.checked.IsZero() || ml.list.stale || !info.ModTime().Equal(ml.list.modTime) {
+		models, err := ml.ListModels()
+		if err != nil {
+			return models, err
+		}
+		ml.list.models = models
+		ml.list.modTime = info.ModTime()
+		ml.list.stale = false
+	}
+	ml.list.checked = time.Now()
+	return ml.list.models, nil
+}
@@ -0,0 +1,36 @@
+package model_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/go-skynet/LocalAI/pkg/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CachedListModels", func() {
+	It("lists the models again when the models path changes", func() {
+		path := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(path, "first.bin"), []byte{}, 0600)).To(Succeed())
+		loader := NewModelLoader(path)
+		Expect(loader.CachedListModels()).To(Equal([]string{"first.bin"}))
+
+		Expect(os.WriteFile(filepath.Join(path, "second.bin"), []byte{}, 0600)).To(Succeed())
+		Eventually(loader.CachedListModels).Should(Equal([]string{"first.bin", "second.bin"}))
+
+		Expect(os.Remove(filepath.Join(path, "first.bin"))).To(Succeed())
+		Eventually(loader.CachedListModels).Should(Equal([]string{"second.bin"}))
+	})
+	It("polls the models path once closed", func() {
+		path := GinkgoT().TempDir()
+		loader := NewModelLoader(path)
+		Expect(loader.CachedListModels()).To(BeEmpty())
+		Expect(loader.Close()).To(Succeed())
+
+		Expect(os.WriteFile(filepath.Join(path, "first.bin"), []byte{}, 0600)).To(Succeed())
+		Eventually(loader.CachedListModels, 2*ModelsListTTL+time.Second).Should(Equal([]string{"first.bin"}))
+		Expect(loader.Close()).To(Succeed())
+	})
+})
@@ -6,19 +6,43 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
 type ModelLoader struct {
 	ModelPath string
-	mu        sync.Mutex
+	// LowMemory keeps a single model in memory, for small devices
+	LowMemory bool
+	// RefuseSwap refuses to load the models bigger than the available memory
+	RefuseSwap bool
+	// RequireLicenseAck refuses to serve the non-commercial models whose
+	// license was not acknowledged in their config
+	RequireLicenseAck bool
+
+	mu sync.Mutex
 	// TODO: this needs generics
 	models           map[string]interface{}
 	promptsTemplates map[string]*template.Template
+	// users counts the requests using each model. The models unloaded while
+	// in use are kept in unloading, and freed once the requests complete
+	users     map[string]int
+	unloading map[string][]interface{}
+
+	eventsMu  sync.Mutex
+	events    []LoadEvent
+	loadStats map[loadStatsKey]*LoadStats
+
+	backendsMu  sync.Mutex
+	unavailable map[string]backendCrash
+
+	listMu sync.Mutex
+	list   modelsList
 }
 
 func NewModelLoader(modelPath string) *ModelLoader {
@@ -26,6 +50,8 @@ func NewModelLoader(modelPath string) *ModelLoader {
 		ModelPath:        modelPath,
 		models:           make(map[string]interface{}),
 		promptsTemplates: make(map[string]*template.Template),
+		users:            make(map[string]int),
+		unloading:        make(map[string][]interface{}),
 	}
 }
 
@@ -42,8 +68,8 @@ func (ml *ModelLoader) ListModels() ([]string, error) {
 
 	models := []string{}
 	for _, file := range files {
-		// Skip templates, YAML and .keep files
-		if strings.HasSuffix(file.Name(), ".tmpl") || strings.HasSuffix(file.Name(), ".keep") || strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml") {
+		// Skip templates, YAML and .keep files, and directories
+		if file.IsDir() || strings.HasSuffix(file.Name(), ".tmpl") || strings.HasSuffix(file.Name(), ".keep") || strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml") {
 			continue
 		}
 
@@ -110,7 +136,13 @@ func (ml *ModelLoader) loadTemplateIfExists(modelName, modelFile string) error {
 	return nil
 }
 
-func (ml *ModelLoader) LoadModel(modelName string, loader func(string) (interface{}, error)) (interface{}, error) {
+func (ml *ModelLoader) LoadModel(backend, modelName string, loader func(string) (interface{}, error)) (interface{}, error) {
+	return ml.loadModel(backend, modelName, nil, loader)
+}
+
+// loadModel loads the model with loader. contextMemory, if not nil, returns
+// the memory the model needs on top of its file, checked with RefuseSwap
+func (ml *ModelLoader) loadModel(backend, modelName string, contextMemory func(modelFile string) int64, loader func(string) (interface{}, error)) (interface{}, error) {
 	ml.mu.Lock()
 	defer ml.mu.Unlock()
 
@@ -120,11 +152,46 @@ func (ml *ModelLoader) LoadModel(modelName string, loader func(string) (interfac
 		return m, nil
 	}
 
+	if err := ml.backendUnavailable(backend); err != nil {
+		return nil, err
+	}
+
 	// Load the model and keep it in memory for later use
 	modelFile := filepath.Join(ml.ModelPath, modelName)
 	log.Debug().Msgf("Loading model in memory from file: %s", modelFile)
 
-	model, err := loader(modelFile)
+	start := time.Now()
+	memBefore := residentMemory()
+	var model interface{}
+	var err error
+	if ml.RefuseSwap {
+		var context int64
+		if contextMemory != nil {
+			context = contextMemory(modelFile)
+		}
+		err = checkAvailableMemory(modelFile, context)
+	}
+	if err == nil {
+		var panicked bool
+		model, panicked, err = safeLoad(loader, modelFile)
+		if panicked {
+			ml.disableBackend(backend, err.Error())
+		}
+	}
+	event := LoadEvent{
+		Model:       modelName,
+		Backend:     backend,
+		Time:        start,
+		Duration:    time.Since(start),
+		Success:     err == nil,
+		MemoryDelta: residentMemory() - memBefore,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.LoadMode = loadMode(modelFile)
+	}
+	ml.recordLoad(event)
 	if err != nil {
 		return nil, err
 	}
@@ -137,3 +204,87 @@ func (ml *ModelLoader) LoadModel(modelName string, loader func(string) (interfac
 	ml.models[modelName] = model
 	return model, nil
 }
+
+// Loaded returns whether the model is in memory
+func (ml *ModelLoader) Loaded(modelName string) bool {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	_, exists := ml.models[modelName]
+	return exists
+}
+
+// LoadedModels returns the names of the models in memory
+func (ml *ModelLoader) LoadedModels() []string {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	models := []string{}
+	for m := range ml.models {
+		models = append(models, m)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Use marks the model as used by a request until the returned function is
+// called, so that it is not freed meanwhile. It is to be called before
+// loading the model, and the returned function once the request doesn't use
+// the model anymore.
+func (ml *ModelLoader) Use(modelName string) func() {
+	ml.mu.Lock()
+	ml.users[modelName]++
+	ml.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ml.mu.Lock()
+			defer ml.mu.Unlock()
+			ml.users[modelName]--
+			if ml.users[modelName] > 0 {
+				return
+			}
+			delete(ml.users, modelName)
+			for _, m := range ml.unloading[modelName] {
+				if err := free(modelName, m); err != nil {
+					log.Error().Msgf("error unloading model %s: %s", modelName, err.Error())
+				}
+			}
+			delete(ml.unloading, modelName)
+		})
+	}
+}
+
+// UnloadModel removes a model from memory, freeing its resources if the
+// backend supports it. A model in use is freed once the requests using it
+// complete, the next requests load it again.
+func (ml *ModelLoader) UnloadModel(modelName string) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	m, ok := ml.models[modelName]
+	if !ok {
+		return fmt.Errorf("model %s is not loaded", modelName)
+	}
+	delete(ml.models, modelName)
+
+	if ml.users[modelName] > 0 {
+		log.Debug().Msgf("Model %s in use, freeing it once the requests complete", modelName)
+		ml.unloading[modelName] = append(ml.unloading[modelName], m)
+		return nil
+	}
+	return free(modelName, m)
+}
+
+// free frees the resources of a model, if the backend supports it
+func free(modelName string, m interface{}) error {
+	log.Debug().Msgf("Unloading model: %s", modelName)
+	switch model := m.(type) {
+	case interface{ Free() }:
+		model.Free()
+	case interface{ Close() error }:
+		if err := model.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package model_test
+
+import (
+	. "github.com/go-skynet/LocalAI/pkg/model"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakeModel struct{ freed bool }
+
+func (m *fakeModel) Free() { m.freed = true }
+
+var _ = Describe("ModelLoader", func() {
+	var loader *ModelLoader
+	var loaded *fakeModel
+	load := func() *fakeModel {
+		m, err := loader.LoadModel(LlamaBackend, "model.bin", func(string) (interface{}, error) {
+			return &fakeModel{}, nil
+		})
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return m.(*fakeModel)
+	}
+	BeforeEach(func() {
+		loader = NewModelLoader(GinkgoT().TempDir())
+		loaded = load()
+	})
+
+	It("frees the unused models", func() {
+		Expect(loader.UnloadModel("model.bin")).To(Succeed())
+		Expect(loaded.freed).To(BeTrue())
+		Expect(loader.LoadedModels()).To(BeEmpty())
+		Expect(loader.UnloadModel("model.bin")).To(HaveOccurred())
+	})
+	It("frees the models in use once the requests complete", func() {
+		release := loader.Use("model.bin")
+		Expect(loader.UnloadModel("model.bin")).To(Succeed())
+		Expect(loaded.freed).To(BeFalse())
+		// the next requests load it again
+		Expect(loader.LoadedModels()).To(BeEmpty())
+
+		other := loader.Use("model.bin")
+		reloaded := load()
+		release()
+		Expect(loaded.freed).To(BeFalse())
+		other()
+		Expect(loaded.freed).To(BeTrue())
+		Expect(reloaded.freed).To(BeFalse())
+	})
+	It("releases a model once", func() {
+		first, second := loader.Use("model.bin"), loader.Use("model.bin")
+		first()
+		first()
+		Expect(loader.UnloadModel("model.bin")).To(Succeed())
+		Expect(loaded.freed).To(BeFalse())
+		second()
+		Expect(loaded.freed).To(BeTrue())
+	})
+})
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	llama "github.com/go-skynet/go-llama.cpp"
+)
+
+// MemoryStats reports the memory of the system, and how much it is under pressure
+type MemoryStats struct {
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+	SwapTotal int64 `json:"swap_total"`
+	SwapFree  int64 `json:"swap_free"`
+	// Resident is the memory used by LocalAI
+	Resident int64 `json:"resident"`
+	// Pressure is the share of time (0-100) some tasks were stalled waiting
+	// for memory in the last 10 and 60 seconds, where the kernel reports it
+	Pressure10 float64 `json:"pressure_avg10"`
+	Pressure60 float64 `json:"pressure_avg60"`
+
+	LoadedModels []string `json:"loaded_models"`
+}
+
+// ReadMemoryStats reads the memory stats from /proc. The values not available
+// on the system are left to 0.
+func (ml *ModelLoader) ReadMemoryStats() (*MemoryStats, error) {
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &MemoryStats{
+		Total:        meminfo["MemTotal"],
+		Available:    meminfo["MemAvailable"],
+		SwapTotal:    meminfo["SwapTotal"],
+		SwapFree:     meminfo["SwapFree"],
+		Resident:     residentMemory(),
+		LoadedModels: ml.LoadedModels(),
+	}
+
+	// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+	if dat, err := os.ReadFile("/proc/pressure/memory"); err == nil {
+		line := strings.SplitN(string(dat), "\n", 2)[0]
+		for _, f := range strings.Fields(line) {
+			k, v, _ := strings.Cut(f, "=")
+			switch k {
+			case "avg10":
+				stats.Pressure10, _ = strconv.ParseFloat(v, 64)
+			case "avg60":
+				stats.Pressure60, _ = strconv.ParseFloat(v, 64)
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// readMeminfo returns the fields of /proc/meminfo in bytes
+func readMeminfo() (map[string]int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("cannot read memory stats: %w", err)
+	}
+	defer f.Close()
+
+	meminfo := map[string]int64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// MemAvailable:    1234567 kB
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		meminfo[k] = n
+	}
+	return meminfo, scanner.Err()
+}
+
+// checkAvailableMemory returns an error if loading the model file, and the
+// context memory on top of it, would not fit in the available memory, and so
+// push the system to swap
+func checkAvailableMemory(modelFile string, contextMemory int64) error {
+	info, err := os.Stat(modelFile)
+	if err != nil {
+		// let the backend report it
+		return nil
+	}
+	meminfo, err := readMeminfo()
+	if err != nil {
+		return nil
+	}
+	available, ok := meminfo["MemAvailable"]
+	if needed := info.Size() + contextMemory; ok && needed > available {
+		return fmt.Errorf("not enough memory to load %s: %d MB needed (%d MB of context), %d MB available", filepath.Base(modelFile), needed>>20, contextMemory>>20, available>>20)
+	}
+	return nil
+}
+
+// the magic numbers of the llama.cpp files: unversioned, versioned and
+// versioned with the tensors aligned for mmap
+const (
+	ggmlMagic = 0x67676d6c
+	ggmfMagic = 0x67676d66
+	ggjtMagic = 0x67676a74
+)
+
+// llamaHparams reads the size of the embeddings and the number of layers
+// from the header of a llama.cpp model file
+func llamaHparams(modelFile string) (nEmbd, nLayer int64, err error) {
+	f, err := os.Open(modelFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var magic uint32
+	if err := binary.Read(f, binary.LittleEndian, &magic); err != nil {
+		return 0, 0, err
+	}
+	switch magic {
+	case ggmlMagic:
+	case ggmfMagic, ggjtMagic:
+		var version uint32
+		if err := binary.Read(f, binary.LittleEndian, &version); err != nil {
+			return 0, 0, err
+		}
+	default:
+		return 0, 0, fmt.Errorf("not a llama.cpp model file")
+	}
+
+	// n_vocab, n_embd, n_mult, n_head, n_layer, n_rot, ftype
+	var hparams [7]int32
+	if err := binary.Read(f, binary.LittleEndian, &hparams); err != nil {
+		return 0, 0, err
+	}
+	return int64(hparams[1]), int64(hparams[4]), nil
+}
+
+// llamaContextMemory returns the function estimating the memory of the
+// context of a llama.cpp model loaded with opts: the keys and the values of
+// the tokens of the context, in every layer. It is 0 for the files it can't read.
+func llamaContextMemory(opts []llama.ModelOption) func(modelFile string) int64 {
+	o := llama.DefaultModelOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(modelFile string) int64 {
+		nEmbd, nLayer, err := llamaHparams(modelFile)
+		if err != nil {
+			return 0
+		}
+		size := int64(4)
+		if o.F16Memory {
+			size = 2
+		}
+		return 2 * nLayer * int64(o.ContextSize) * nEmbd * size
+	}
+}
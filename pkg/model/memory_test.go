@@ -0,0 +1,53 @@
+package model
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+
+	llama "github.com/go-skynet/go-llama.cpp"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memory", func() {
+	// writeLlamaFile writes the header of a ggjt file
+	writeLlamaFile := func(nEmbd, nLayer int32) string {
+		file := filepath.Join(GinkgoT().TempDir(), "model.bin")
+		f, err := os.Create(file)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		defer f.Close()
+		header := []interface{}{uint32(ggjtMagic), uint32(1), [7]int32{32000, nEmbd, 256, 32, nLayer, 128, 2}}
+		for _, v := range header {
+			ExpectWithOffset(1, binary.Write(f, binary.LittleEndian, v)).To(Succeed())
+		}
+		return file
+	}
+
+	It("reads the header of the llama files", func() {
+		nEmbd, nLayer, err := llamaHparams(writeLlamaFile(4096, 32))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(nEmbd).To(Equal(int64(4096)))
+		Expect(nLayer).To(Equal(int64(32)))
+
+		other := filepath.Join(GinkgoT().TempDir(), "model.bin")
+		Expect(os.WriteFile(other, []byte("not a model"), 0600)).To(Succeed())
+		_, _, err = llamaHparams(other)
+		Expect(err).To(HaveOccurred())
+	})
+	It("estimates the context memory of the llama models", func() {
+		file := writeLlamaFile(4096, 32)
+		// 7B, 2048 tokens of context: 1 GB in 16 bit floats
+		Expect(llamaContextMemory([]llama.ModelOption{llama.SetContext(2048), llama.EnableF16Memory})(file)).To(Equal(int64(1 << 30)))
+		Expect(llamaContextMemory([]llama.ModelOption{llama.SetContext(2048)})(file)).To(Equal(int64(2 << 30)))
+		Expect(llamaContextMemory(nil)(filepath.Join(GinkgoT().TempDir(), "missing.bin"))).To(BeZero())
+	})
+	It("refuses the models not fitting in the available memory with their context", func() {
+		if _, err := readMeminfo(); err != nil {
+			Skip("no memory stats on this system")
+		}
+		file := writeLlamaFile(4096, 32)
+		Expect(checkAvailableMemory(file, 0)).To(Succeed())
+		Expect(checkAvailableMemory(file, 1<<60)).To(MatchError(ContainSubstring("not enough memory to load model.bin")))
+	})
+})
@@ -0,0 +1,66 @@
+package schedule_test
+
+import (
+	"time"
+
+	. "github.com/go-skynet/LocalAI/pkg/schedule"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cron", func() {
+	// Monday
+	start := time.Date(2023, time.May, 15, 10, 30, 0, 0, time.UTC)
+
+	It("rejects invalid expressions", func() {
+		for _, expr := range []string{"* * * *", "60 * * * *", "a * * * *", "*/0 * * * *", "5-1 * * * *"} {
+			_, err := Parse(expr)
+			Expect(err).To(HaveOccurred(), expr)
+		}
+	})
+	It("fires every minute", func() {
+		c, err := Parse("* * * * *")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Matches(start)).To(BeTrue())
+		Expect(c.Matches(start.Add(time.Minute))).To(BeTrue())
+	})
+	It("handles steps", func() {
+		c, err := Parse("*/15 * * * *")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Matches(start)).To(BeTrue())
+		Expect(c.Matches(start.Add(5 * time.Minute))).To(BeFalse())
+		Expect(c.Matches(start.Add(15 * time.Minute))).To(BeTrue())
+	})
+	It("handles business days", func() {
+		c, err := Parse("0 8 * * 1-5")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Matches(start)).To(BeFalse())
+		Expect(c.Matches(time.Date(2023, time.May, 16, 8, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(c.Matches(time.Date(2023, time.May, 16, 8, 1, 0, 0, time.UTC))).To(BeFalse())
+
+		// not on the weekend
+		Expect(c.Matches(time.Date(2023, time.May, 20, 8, 0, 0, 0, time.UTC))).To(BeFalse())
+		Expect(c.Matches(time.Date(2023, time.May, 22, 8, 0, 0, 0, time.UTC))).To(BeTrue())
+	})
+	It("handles lists and Sunday as 7", func() {
+		c, err := Parse("0 3 * * 7")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Matches(time.Date(2023, time.May, 21, 3, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(c.Matches(time.Date(2023, time.May, 20, 3, 0, 0, 0, time.UTC))).To(BeFalse())
+
+		c, err = Parse("0 9,18 1 * *")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Matches(time.Date(2023, time.June, 1, 9, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(c.Matches(time.Date(2023, time.June, 1, 18, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(c.Matches(time.Date(2023, time.June, 1, 12, 0, 0, 0, time.UTC))).To(BeFalse())
+		Expect(c.Matches(time.Date(2023, time.June, 2, 9, 0, 0, 0, time.UTC))).To(BeFalse())
+	})
+	It("fires on either day when both are restricted", func() {
+		c, err := Parse("0 0 1 * 1")
+		Expect(err).ToNot(HaveOccurred())
+		// the 1st of June 2023 is a Thursday, the 5th a Monday
+		Expect(c.Matches(time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(c.Matches(time.Date(2023, time.June, 5, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+		Expect(c.Matches(time.Date(2023, time.June, 6, 0, 0, 0, 0, time.UTC))).To(BeFalse())
+	})
+})
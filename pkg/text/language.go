@@ -0,0 +1,142 @@
+package text
+
+import (
+	"strings"
+	"unicode"
+)
+
+// scripts are the writing systems used by a single language of the list
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "Korean"},
+	{unicode.Hiragana, "Japanese"},
+	{unicode.Katakana, "Japanese"},
+	{unicode.Han, "Chinese"},
+	{unicode.Greek, "Greek"},
+	{unicode.Arabic, "Arabic"},
+	{unicode.Hebrew, "Hebrew"},
+	{unicode.Devanagari, "Hindi"},
+	{unicode.Thai, "Thai"},
+}
+
+// stopwords are the most frequent words of the languages written with the
+// latin or the cyrillic alphabet, which tell them apart
+var stopwords = map[string][]string{
+	"English":    {"the", "and", "is", "are", "of", "to", "in", "it", "that", "you", "this", "with", "for", "was", "have", "not", "be", "on"},
+	"Italian":    {"il", "lo", "la", "gli", "le", "di", "che", "è", "non", "per", "sono", "una", "con", "del", "della", "questo", "anche", "come"},
+	"French":     {"le", "la", "les", "de", "des", "et", "est", "une", "que", "pas", "pour", "dans", "ce", "qui", "sur", "avec", "je", "vous"},
+	"Spanish":    {"el", "la", "los", "las", "de", "y", "es", "que", "una", "por", "para", "con", "no", "del", "se", "como", "está", "pero"},
+	"Portuguese": {"o", "os", "as", "de", "e", "é", "que", "um", "uma", "não", "para", "com", "do", "da", "em", "por", "mais", "você"},
+	"German":     {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "mit", "ich", "sie", "den", "auf", "es", "für", "sind", "auch"},
+	"Dutch":      {"de", "het", "een", "en", "is", "van", "niet", "dat", "ik", "je", "op", "te", "zijn", "met", "voor", "maar", "ook", "wat"},
+	"Russian":    {"и", "в", "не", "на", "что", "я", "с", "он", "как", "это", "по", "но", "они", "мы", "из", "у", "так", "его"},
+	"Ukrainian":  {"і", "в", "не", "на", "що", "я", "з", "він", "як", "це", "та", "але", "вони", "ми", "із", "у", "так", "його"},
+}
+
+var stopwordSets = func() map[string]map[string]bool {
+	sets := map[string]map[string]bool{}
+	for language, words := range stopwords {
+		sets[language] = map[string]bool{}
+		for _, w := range words {
+			sets[language][w] = true
+		}
+	}
+	return sets
+}()
+
+// languageCodes are the ISO 639-1 codes of the languages of the list
+var languageCodes = map[string]string{
+	"Korean":     "ko",
+	"Japanese":   "ja",
+	"Chinese":    "zh",
+	"Greek":      "el",
+	"Arabic":     "ar",
+	"Hebrew":     "he",
+	"Hindi":      "hi",
+	"Thai":       "th",
+	"English":    "en",
+	"Italian":    "it",
+	"French":     "fr",
+	"Spanish":    "es",
+	"Portuguese": "pt",
+	"German":     "de",
+	"Dutch":      "nl",
+	"Russian":    "ru",
+	"Ukrainian":  "uk",
+}
+
+// LanguageCode returns the ISO 639-1 code of a language DetectLanguage
+// knows, given its English name or its code, with or without a region (e.g.
+// "pt-BR"). It returns an empty string for the other languages.
+func LanguageCode(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		language = language[:i]
+	}
+	for name, code := range languageCodes {
+		if language == strings.ToLower(name) || language == code {
+			return code
+		}
+	}
+	return ""
+}
+
+// DetectLanguage returns the English name of the language s is written in,
+// or an empty string if it can't tell. The languages with their own script
+// are recognized by it, the others by their most frequent words: only the
+// languages listed in scripts and stopwords are known.
+func DetectLanguage(s string) string {
+	letters := 0
+	counts := map[string]int{}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// the kanji are Han characters, the kana tell Japanese apart
+	if counts["Japanese"] > 0 {
+		return "Japanese"
+	}
+	for _, script := range scripts {
+		if counts[script.language]*2 > letters {
+			return script.language
+		}
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	best, bestScore, tie := "", 0, false
+	for language, set := range stopwordSets {
+		score := 0
+		for _, w := range words {
+			if set[w] {
+				score++
+			}
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tie = language, score, false
+		case score == bestScore:
+			tie = true
+		}
+	}
+	// a word or two might be shared by the languages by chance
+	if tie || bestScore < 2 {
+		return ""
+	}
+	return best
+}
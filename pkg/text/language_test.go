@@ -0,0 +1,44 @@
+package text_test
+
+import (
+	. "github.com/go-skynet/LocalAI/pkg/text"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DetectLanguage", func() {
+	It("recognizes the languages by their frequent words", func() {
+		Expect(DetectLanguage("The cat is on the table, and it is sleeping.")).To(Equal("English"))
+		Expect(DetectLanguage("Il gatto è sul tavolo e non si muove per niente.")).To(Equal("Italian"))
+		Expect(DetectLanguage("Le chat est sur la table et il ne bouge pas.")).To(Equal("French"))
+		Expect(DetectLanguage("El gato está en la mesa y no se mueve para nada.")).To(Equal("Spanish"))
+		Expect(DetectLanguage("Die Katze ist auf dem Tisch und sie schläft nicht.")).To(Equal("German"))
+		Expect(DetectLanguage("Кошка на столе, и она не спит, как и я.")).To(Equal("Russian"))
+	})
+	It("recognizes the languages by their script", func() {
+		Expect(DetectLanguage("猫在桌子上")).To(Equal("Chinese"))
+		Expect(DetectLanguage("猫はテーブルの上にいます")).To(Equal("Japanese"))
+		Expect(DetectLanguage("고양이가 테이블 위에 있어요")).To(Equal("Korean"))
+		Expect(DetectLanguage("Η γάτα είναι στο τραπέζι")).To(Equal("Greek"))
+	})
+	It("doesn't guess", func() {
+		Expect(DetectLanguage("")).To(BeEmpty())
+		Expect(DetectLanguage("1234 !!")).To(BeEmpty())
+		Expect(DetectLanguage("Lorem ipsum dolor sit amet")).To(BeEmpty())
+	})
+})
+
+var _ = Describe("LanguageCode", func() {
+	It("normalizes the names and the codes of the languages", func() {
+		Expect(LanguageCode("Italian")).To(Equal("it"))
+		Expect(LanguageCode(" english ")).To(Equal("en"))
+		Expect(LanguageCode("pt-BR")).To(Equal("pt"))
+		Expect(LanguageCode("zh")).To(Equal("zh"))
+	})
+	It("doesn't know the other languages", func() {
+		Expect(LanguageCode("Old English")).To(BeEmpty())
+		Expect(LanguageCode("Chinese Traditional")).To(BeEmpty())
+		Expect(LanguageCode("Klingon")).To(BeEmpty())
+		Expect(LanguageCode("")).To(BeEmpty())
+	})
+})
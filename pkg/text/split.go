@@ -0,0 +1,55 @@
+package text
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// separators are tried in order to find a natural boundary to split the text
+var separators = []string{"\n\n", "\n", ". ", " "}
+
+// Split splits s in chunks of at most size bytes, cutting at paragraph,
+// line, sentence or word boundaries when possible. Chunks are trimmed of
+// surrounding whitespace, and empty chunks are dropped.
+func Split(s string, size int) []string {
+	chunks := []string{}
+	if size <= 0 {
+		size = len(s)
+	}
+
+	for len(s) > 0 {
+		if len(s) <= size {
+			chunks = appendChunk(chunks, s)
+			break
+		}
+
+		cut := size
+		// never cut in the middle of a multi-byte character
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			_, cut = utf8.DecodeRuneInString(s)
+		}
+		for _, sep := range separators {
+			// don't produce tiny chunks just to honor a boundary
+			if i := strings.LastIndex(s[:cut], sep); i > cut/2 {
+				cut = i + len(sep)
+				break
+			}
+		}
+
+		chunks = appendChunk(chunks, s[:cut])
+		s = s[cut:]
+	}
+
+	return chunks
+}
+
+func appendChunk(chunks []string, s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return chunks
+	}
+	return append(chunks, s)
+}
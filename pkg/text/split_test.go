@@ -0,0 +1,39 @@
+package text_test
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/go-skynet/LocalAI/pkg/text"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Split", func() {
+	It("returns short texts as a single chunk", func() {
+		Expect(Split("hello world", 100)).To(Equal([]string{"hello world"}))
+	})
+	It("returns no chunks for empty texts", func() {
+		Expect(Split("  ", 100)).To(BeEmpty())
+	})
+	It("splits at paragraph boundaries", func() {
+		s := strings.Repeat("a", 60) + "\n\n" + strings.Repeat("b", 60)
+		Expect(Split(s, 100)).To(Equal([]string{strings.Repeat("a", 60), strings.Repeat("b", 60)}))
+	})
+	It("splits at sentence boundaries", func() {
+		s := "The cat sat on the mat. The dog sat on the log."
+		Expect(Split(s, 30)).To(Equal([]string{"The cat sat on the mat.", "The dog sat on the log."}))
+	})
+	It("does not split multi-byte characters", func() {
+		for _, c := range Split(strings.Repeat("è", 100), 51) {
+			Expect(utf8.ValidString(c)).To(BeTrue())
+		}
+	})
+	It("cuts long words", func() {
+		chunks := Split(strings.Repeat("a", 250), 100)
+		Expect(chunks).To(HaveLen(3))
+		for _, c := range chunks {
+			Expect(len(c)).To(BeNumerically("<=", 100))
+		}
+	})
+})
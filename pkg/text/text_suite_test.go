@@ -0,0 +1,13 @@
+package text_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestText(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Text test suite")
+}
@@ -0,0 +1,21 @@
+package vector
+
+import "fmt"
+
+// Cosine returns the cosine similarity between a and b
+func Cosine(a, b []float32) (float64, error) {
+	if len(a) != len(b) {
+		return 0, fmt.Errorf("vectors have different dimensions: %d and %d", len(a), len(b))
+	}
+
+	na, nb := Norm(a), Norm(b)
+	if na == 0 || nb == 0 {
+		return 0, fmt.Errorf("cosine similarity is not defined for zero vectors")
+	}
+
+	dot := 0.0
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot / (na * nb), nil
+}
@@ -0,0 +1,31 @@
+package vector_test
+
+import (
+	. "github.com/go-skynet/LocalAI/pkg/vector"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cosine", func() {
+	It("computes the cosine similarity", func() {
+		s, err := Cosine([]float32{1, 0}, []float32{1, 0})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(BeNumerically("~", 1, 1e-6))
+
+		s, err = Cosine([]float32{1, 0}, []float32{0, 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(BeNumerically("~", 0, 1e-6))
+
+		s, err = Cosine([]float32{1, 1}, []float32{-1, -1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s).To(BeNumerically("~", -1, 1e-6))
+	})
+	It("fails on mismatching dimensions", func() {
+		_, err := Cosine([]float32{1, 0}, []float32{1, 0, 0})
+		Expect(err).To(HaveOccurred())
+	})
+	It("fails on zero vectors", func() {
+		_, err := Cosine([]float32{0, 0}, []float32{1, 0})
+		Expect(err).To(HaveOccurred())
+	})
+})
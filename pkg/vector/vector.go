@@ -0,0 +1,26 @@
+package vector
+
+import "math"
+
+// Norm returns the euclidean (L2) norm of v
+func Norm(v []float32) float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// Normalize returns a copy of v scaled to unit length. Zero vectors are returned unchanged
+func Normalize(v []float32) []float32 {
+	out := make([]float32, len(v))
+	n := Norm(v)
+	if n == 0 {
+		copy(out, v)
+		return out
+	}
+	for i, x := range v {
+		out[i] = float32(float64(x) / n)
+	}
+	return out
+}
@@ -0,0 +1,20 @@
+package vector_test
+
+import (
+	. "github.com/go-skynet/LocalAI/pkg/vector"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Vector", func() {
+	It("normalizes vectors", func() {
+		v := Normalize([]float32{3, 4})
+		Expect(v).To(HaveLen(2))
+		Expect(v[0]).To(BeNumerically("~", 0.6, 1e-6))
+		Expect(v[1]).To(BeNumerically("~", 0.8, 1e-6))
+		Expect(Norm(v)).To(BeNumerically("~", 1, 1e-6))
+	})
+	It("leaves zero vectors unchanged", func() {
+		Expect(Normalize([]float32{0, 0})).To(Equal([]float32{0, 0}))
+	})
+})